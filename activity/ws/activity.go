@@ -1,16 +1,12 @@
 package ws
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +17,11 @@ import (
 	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/metadata"
 	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/websocket/internal/handshake"
+	"github.com/project-flogo/websocket/internal/heartbeat"
+	"github.com/project-flogo/websocket/internal/oauth"
+	"github.com/project-flogo/websocket/internal/proxyconfig"
+	"github.com/project-flogo/websocket/internal/tlsconfig"
 )
 
 func init() {
@@ -36,10 +37,36 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := ctx.Settings()["heartbeatInterval"]; !ok {
+		s.HeartbeatInterval = 30
+	}
+	if _, ok := ctx.Settings()["heartbeatTimeout"]; !ok {
+		s.HeartbeatTimeout = 10
+	}
+	if _, ok := ctx.Settings()["oauthRenewBefore"]; !ok {
+		s.OAuthRenewBefore = 60
+	}
+	hb, err := heartbeat.New(s.HeartbeatMessage, s.HeartbeatResponse,
+		time.Duration(s.HeartbeatInterval)*time.Second, time.Duration(s.HeartbeatTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
 	act := &Activity{
 		settings:      s,
 		cachedClients: sync.Map{},
 		continuePing:  true,
+		heartbeat:     hb,
+	}
+	act.tokens, err = act.tokenSource(ctx.Logger())
+	if err != nil {
+		return nil, err
+	}
+	if s.CookieJar {
+		// shared by all connections of the activity
+		act.jar, err = cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return act, nil
 }
@@ -50,6 +77,11 @@ type Activity struct {
 	cachedClients sync.Map
 	continuePing  bool
 	actLogger     log.Logger
+	heartbeat     *heartbeat.Heartbeat
+	tokens        *oauth.Source
+	jar           http.CookieJar
+	handshakes    sync.Map
+	writeMu       sync.Mutex
 }
 
 // Metadata returns the metadata for a websocket client
@@ -85,47 +117,43 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	if !ok {
 		var dialer websocket.Dialer
 		if isWSS {
-			tlsconfig := &tls.Config{}
-			allowInsecure := a.settings.AllowInsecure
-			if allowInsecure {
-				tlsconfig.InsecureSkipVerify = true
-			} else {
-				var cacertObj map[string]interface{}
-				if a.settings.CaCert != "" {
-					err = json.Unmarshal([]byte(a.settings.CaCert), &cacertObj)
-					if err != nil { //file path configured
-						certPool, err := getCerts(a.settings.CaCert)
-						if err != nil {
-							ctx.Logger().Errorf("Error while loading client trust store - %v", err)
-							return false, err
-						}
-						tlsconfig.RootCAs = certPool
-					} else { // file content configured
-						rootCAbytes, err := decodeCerts(a.settings.CaCert, ctx.Logger())
-						if err != nil {
-							ctx.Logger().Errorf("Error while loading client trust store content - %v", err)
-							return false, err
-						}
-						certPool := x509.NewCertPool()
-						certsAdded := certPool.AppendCertsFromPEM(rootCAbytes)
-						if !certsAdded {
-							ctx.Logger().Error("Unsupported certificate found. It must be a valid PEM certificate.")
-							return false, activity.NewError("Unsupported certificate found. It must be a valid PEM certificate.", "", nil)
-						}
-						tlsconfig.RootCAs = certPool
-					}
-				}
+			tlsConf, err := a.tlsConfig().ClientConfig(ctx.Logger())
+			if err != nil {
+				ctx.Logger().Error(err)
+				return false, err
 			}
-			dialer = websocket.Dialer{TLSClientConfig: tlsconfig}
+			dialer = websocket.Dialer{TLSClientConfig: tlsConf}
 		} else {
 			dialer = *websocket.DefaultDialer
 		}
+		dialer.Proxy, err = a.proxyConfig().ProxyFunc()
+		if err != nil {
+			ctx.Logger().Error(err)
+			return false, err
+		}
+		if a.jar != nil {
+			dialer.Jar = a.jar
+		}
+		// the access token isn't part of the cache key, the dialed url may carry it
+		dialURL, header := builtURL, h
+		var token *oauth.Token
+		if a.tokens != nil {
+			dialURL, header, token, err = a.tokens.Apply(builtURL, h)
+			if err != nil {
+				ctx.Logger().Errorf("error while fetching access token: %s", err)
+				return false, err
+			}
+		}
 		ctx.Logger().Debug("Creating new connection")
 		ctx.Logger().Infof("dialing websocket endpoint[%s]...", builtURL)
 		ctx.Logger().Debugf("dialing websocket endpoint with headers[%s]...", h)
-		conn, res, err := dialer.Dial(builtURL, h)
+		conn, res, err := dialer.Dial(dialURL, header)
 		if err != nil {
 			if res != nil {
+				if a.tokens != nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+					// fetch a new token for the next invocation
+					a.tokens.Invalidate()
+				}
 				defer res.Body.Close()
 				body, err1 := ioutil.ReadAll(res.Body)
 				if err1 != nil {
@@ -136,7 +164,11 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 			return false, err
 		}
 		a.cachedClients.Store(key, conn)
+		a.handshakes.Store(key, handshake.Response(res))
 		connection = conn
+		if token != nil {
+			a.scheduleRenewal(connection, token)
+		}
 
 		// send ping to avoid connection timeout, for newly created connection only as its goroutine
 		connection.SetPongHandler(func(msg string) error { /* ws.SetReadDeadline(time.Now().Add(pongWait)); */
@@ -145,6 +177,9 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		})
 		// send ping to avoid TCI connection timeout
 		go ping(connection, a)
+		if a.heartbeat != nil {
+			a.startHeartbeat(connection)
+		}
 	} else {
 		ctx.Logger().Debug("Reusing connection from cache")
 		connection = cachedConnection.(*websocket.Conn)
@@ -156,18 +191,148 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		if err != nil {
 			return false, err
 		}
+		a.writeMu.Lock()
 		err = connection.WriteMessage(websocket.TextMessage, message)
+		a.writeMu.Unlock()
 		if err != nil {
 			ctx.Logger().Debug("Deleting connection from cache due to error")
 			a.cachedClients.Delete(key)
+			a.handshakes.Delete(key)
 			return false, err
 		}
 	} else {
 		return false, errors.New("Message is not configured")
 	}
+	out := &Output{}
+	if response, ok := a.handshakes.Load(key); ok {
+		out.Handshake = response.(map[string]interface{})
+	}
+	err = ctx.SetOutputObject(out)
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+// startHeartbeat sends the application level heartbeat on a new connection.
+// Received messages are read to look for the responses and discarded, when
+// the response doesn't arrive in time the connection is removed from the
+// cache so that the next invocation reconnects
+func (a *Activity) startHeartbeat(connection *websocket.Conn) {
+	monitor := a.heartbeat.Monitor()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := connection.ReadMessage()
+			if err != nil {
+				a.actLogger.Debugf("stopping heartbeat for conn: %p as received error while reading: %s", connection, err)
+				return
+			}
+			if !monitor.Received(message) {
+				a.actLogger.Debugf("discarding received message: %s", message)
+			}
+		}
+	}()
+	go func() {
+		err := monitor.Run(func(message []byte) error {
+			a.writeMu.Lock()
+			defer a.writeMu.Unlock()
+			a.actLogger.Debugf("sending heartbeat: %s", message)
+			return connection.WriteMessage(websocket.TextMessage, message)
+		}, done)
+		if err != nil {
+			a.actLogger.Warnf("closing conn: %p - %s", connection, err)
+			a.removeConnection(connection)
+			connection.Close()
+		}
+	}()
+}
+
+// scheduleRenewal closes the connection before its access token expires, the
+// next invocation then connects with a new token
+func (a *Activity) scheduleRenewal(connection *websocket.Conn, token *oauth.Token) {
+	if token.Expiry.IsZero() {
+		return
+	}
+	d := time.Until(token.Expiry) - time.Duration(a.settings.OAuthRenewBefore)*time.Second
+	if d <= 0 {
+		a.actLogger.Warnf("access token expires in less than oauthRenewBefore, conn: %p is not renewed", connection)
+		return
+	}
+	time.AfterFunc(d, func() {
+		a.actLogger.Infof("closing conn: %p before its access token expires", connection)
+		a.writeMu.Lock()
+		defer a.writeMu.Unlock()
+		a.removeConnection(connection)
+		connection.Close()
+	})
+}
+
+func (a *Activity) tokenSource(logger log.Logger) (*oauth.Source, error) {
+	if a.settings.OAuthTokenURL == "" {
+		return nil, nil
+	}
+	tlsConf, err := a.tlsConfig().ClientConfig(logger)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := a.proxyConfig().ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	return oauth.NewSource(&oauth.Config{
+		TokenURL:     a.settings.OAuthTokenURL,
+		ClientID:     a.settings.OAuthClientID,
+		ClientSecret: a.settings.OAuthClientSecret,
+		Scopes:       a.settings.OAuthScopes,
+		AuthStyle:    a.settings.OAuthAuthStyle,
+		TokenIn:      a.settings.OAuthTokenIn,
+		TokenName:    a.settings.OAuthTokenName,
+		RenewBefore:  time.Duration(a.settings.OAuthRenewBefore) * time.Second,
+	}, &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: proxy, TLSClientConfig: tlsConf},
+	})
+}
+
+// removeConnection removes a broken connection and its handshake response
+// from the cache
+func (a *Activity) removeConnection(connection *websocket.Conn) {
+	a.cachedClients.Range(func(key, value interface{}) bool {
+		conn, ok := value.(*websocket.Conn)
+		if ok && (connection == conn) {
+			a.actLogger.Warnf("Removing broken connection from cache: [%p] for key: [%s]", conn, key)
+			a.cachedClients.Delete(key)
+			a.handshakes.Delete(key)
+			return false
+		}
+		return true
+	})
+}
+
+func (a *Activity) tlsConfig() *tlsconfig.Config {
+	return &tlsconfig.Config{
+		AllowInsecure: a.settings.AllowInsecure,
+		CaCert:        a.settings.CaCert,
+		Cert:          a.settings.ClientCert,
+		Key:           a.settings.ClientKey,
+		Password:      a.settings.CertPassword,
+		MinVersion:    a.settings.MinTLSVersion,
+		MaxVersion:    a.settings.MaxTLSVersion,
+		CipherSuites:  a.settings.CipherSuites,
+	}
+}
+
+func (a *Activity) proxyConfig() *proxyconfig.Config {
+	return &proxyconfig.Config{
+		URL:      a.settings.ProxyURL,
+		User:     a.settings.ProxyUser,
+		Password: a.settings.ProxyPassword,
+		NoProxy:  a.settings.NoProxy,
+	}
+}
+
 func buildURI(uri string, param *Parameters, log log.Logger) string {
 	if param != nil {
 		if param.PathParams != nil && len(param.PathParams) > 0 {
@@ -207,89 +372,6 @@ func getHeaders(ctx activity.Context, param *Parameters) http.Header {
 	return header
 }
 
-func decodeCerts(certVal string, log log.Logger) ([]byte, error) {
-	if certVal == "" {
-		return nil, fmt.Errorf("Certificate is Empty")
-	}
-
-	//if certificate comes from fileselctor it will be base64 encoded
-	if strings.HasPrefix(certVal, "{") {
-		log.Info("Certificate received from FileSelector")
-		certObj, err := coerce.ToObject(certVal)
-		if err == nil {
-			certRealValue, ok := certObj["content"].(string)
-			log.Infof("Fetched Content from Certificate Object")
-			if !ok || certRealValue == "" {
-				return nil, fmt.Errorf("Didn't found the certificate content")
-			}
-
-			index := strings.IndexAny(certRealValue, ",")
-			if index > -1 {
-				certRealValue = certRealValue[index+1:]
-			}
-
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, err
-	}
-
-	//if the certificate comes from application properties need to check whether that it contains , ans encoding
-	index := strings.IndexAny(certVal, ",")
-
-	if index > -1 {
-		//some encoding is there
-		log.Debugf("Certificate received from App properties with encoding")
-		encoding := certVal[:index]
-		certRealValue := certVal[index+1:]
-
-		if strings.EqualFold(encoding, "base64") {
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, fmt.Errorf("Error in parsing the certificates Or we may be not be supporting the given encoding")
-	}
-
-	log.Debugf("Certificate received from App properties without encoding")
-
-	first := strings.TrimSpace(certVal[:strings.Index(certVal, "----- ")] + "-----")
-	middle := strings.TrimSpace(certVal[strings.Index(certVal, "----- ")+5 : strings.Index(certVal, " -----")])
-	strings.Replace(middle, " ", "\n", -1)
-	last := strings.TrimSpace(certVal[strings.Index(certVal, " -----"):])
-	certVal = first + "\n" + middle + "\n" + last
-
-	return []byte(certVal), nil
-}
-
-func getCerts(trustStore string) (*x509.CertPool, error) {
-	certPool := x509.NewCertPool()
-	fileInfo, err := os.Stat(trustStore)
-	if err != nil {
-		return certPool, fmt.Errorf("Truststore [%s] does not exist", trustStore)
-	}
-	switch mode := fileInfo.Mode(); {
-	case mode.IsDir():
-		break
-	case mode.IsRegular():
-		return certPool, fmt.Errorf("Truststore [%s] is not a directory.  Must be a directory containing trusted certificates in PEM format",
-			trustStore)
-	}
-	trustedCertFiles, err := ioutil.ReadDir(trustStore)
-	if err != nil || len(trustedCertFiles) == 0 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  Must be a directory containing trusted certificates in PEM format", trustStore)
-	}
-	for _, trustCertFile := range trustedCertFiles {
-		fqfName := fmt.Sprintf("%s%c%s", trustStore, os.PathSeparator, trustCertFile.Name())
-		trustCertBytes, err := ioutil.ReadFile(fqfName)
-		if err != nil {
-			fmt.Errorf("Failed to read trusted certificate [%s] ... continueing", trustCertFile.Name())
-		}
-		certPool.AppendCertsFromPEM(trustCertBytes)
-	}
-	if len(certPool.Subjects()) < 1 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  After processing all files in the directory no valid trusted certs were found", trustStore)
-	}
-	return certPool, nil
-}
-
 func ping(connection *websocket.Conn, a *Activity) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -306,15 +388,7 @@ func ping(connection *websocket.Conn, a *Activity) {
 						if !ok || !e.Temporary() {
 							a.actLogger.Warnf("stopping ping ticker for conn: %p as received non temporary error while sending ping: %s ", connection, err.Error())
 							if a.continuePing { // remove connection from cache only if engine is not in shutting down state
-								a.cachedClients.Range(func(key, value interface{}) bool {
-									conn, ok := value.(*websocket.Conn)
-									if ok && (connection == conn) {
-										a.actLogger.Warnf("Removing broken connection from cache: [%p] for key: [%s]", conn, key)
-										a.cachedClients.Delete(key)
-										return false
-									}
-									return true
-								})
+								a.removeConnection(connection)
 							}
 							return
 						}
@@ -4,9 +4,32 @@ import "github.com/project-flogo/core/data/coerce"
 
 // Settings are the settings for the websocket proxy
 type Settings struct {
-	URI           string `md:"uri,required"`
-	AllowInsecure bool   `md:"allowInsecure"`
-	CaCert        string `md:"caCert"`
+	URI               string `md:"uri,required"`
+	AllowInsecure     bool   `md:"allowInsecure"`
+	CaCert            string `md:"caCert"`
+	ClientCert        string `md:"clientCert"`
+	ClientKey         string `md:"clientKey"`
+	CertPassword      string `md:"certPassword"`
+	MinTLSVersion     string `md:"minTLSVersion"`
+	MaxTLSVersion     string `md:"maxTLSVersion"`
+	CipherSuites      string `md:"cipherSuites"`
+	ProxyURL          string `md:"proxyURL"`
+	ProxyUser         string `md:"proxyUser"`
+	ProxyPassword     string `md:"proxyPassword"`
+	NoProxy           string `md:"noProxy"`
+	CookieJar         bool   `md:"cookieJar"`
+	OAuthTokenURL     string `md:"oauthTokenURL"`
+	OAuthClientID     string `md:"oauthClientId"`
+	OAuthClientSecret string `md:"oauthClientSecret"`
+	OAuthScopes       string `md:"oauthScopes"`
+	OAuthAuthStyle    string `md:"oauthAuthStyle"`
+	OAuthTokenIn      string `md:"oauthTokenIn"`
+	OAuthTokenName    string `md:"oauthTokenName"`
+	OAuthRenewBefore  int    `md:"oauthRenewBefore"`
+	HeartbeatMessage  string `md:"heartbeatMessage"`
+	HeartbeatInterval int    `md:"heartbeatInterval"`
+	HeartbeatResponse string `md:"heartbeatResponse"`
+	HeartbeatTimeout  int    `md:"heartbeatTimeout"`
 }
 
 // Input is the input into the websocket proxy
@@ -47,4 +70,21 @@ func (i *Input) FromMap(values map[string]interface{}) (err error) {
 
 // Output is the output of the websocket proxy
 type Output struct {
+	Handshake map[string]interface{} `md:"handshake"`
+}
+
+// ToMap converts the output into a map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"handshake": o.Handshake,
+	}
+}
+
+// FromMap converts the values from a map to a struct
+func (o *Output) FromMap(values map[string]interface{}) (err error) {
+	o.Handshake, err = coerce.ToObject(values["handshake"])
+	if err != nil {
+		return err
+	}
+	return nil
 }
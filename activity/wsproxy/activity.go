@@ -1,11 +1,20 @@
 package wsproxy
 
 import (
+	"fmt"
+	"net"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/websocket/internal/proxyconfig"
+	"github.com/project-flogo/websocket/internal/tlsconfig"
 )
 
 func init() {
@@ -16,12 +25,33 @@ const (
 	defaultMaxConnections = 5
 )
 
+const (
+	// ModeAsync returns right away while the session is proxied in the background
+	ModeAsync = "Async"
+	// ModeSync waits for the end of the session and returns its stats
+	ModeSync = "Sync"
+)
+
 // WSProxy is websocket proxy service
 type WSProxy struct {
 	serviceName    string
-	backendURL     string
+	balancer       *balancer
 	maxConnections int
 	clientConn     *websocket.Conn
+	dialer         *websocket.Dialer
+	request        http.Header
+	header         http.Header
+	pathParams     map[string]string
+	queryParams    map[string]interface{}
+	forwardQuery   bool
+	upstream       *interceptor
+	downstream     *interceptor
+	keepalive      *keepalive
+	resume         *resume
+	shadow         *shadow
+	bridge         *bridge
+	tcp            bool
+	logger         log.Logger
 }
 
 var activityMd = activity.ToMetadata(&Settings{}, &Input{}, &Output{})
@@ -34,14 +64,189 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 		return nil, err
 	}
 
-	act := &Activity{settings: s}
+	switch {
+	case s.Mode == "" || strings.EqualFold(s.Mode, ModeAsync):
+		s.Mode = ModeAsync
+	case strings.EqualFold(s.Mode, ModeSync):
+		s.Mode = ModeSync
+	default:
+		return nil, fmt.Errorf("unsupported mode [%s]", s.Mode)
+	}
+	if _, ok := ctx.Settings()["forwardedHeaders"]; !ok {
+		s.ForwardedHeaders = true
+	}
+	if _, ok := ctx.Settings()["healthCheckInterval"]; !ok {
+		s.HealthCheckInterval = 10
+	}
+	if _, ok := ctx.Settings()["healthCheckTimeout"]; !ok {
+		s.HealthCheckTimeout = 5
+	}
+	if _, ok := ctx.Settings()["pongTimeout"]; !ok {
+		s.PongTimeout = 10
+	}
+	if _, ok := ctx.Settings()["backendReconnectInitialDelay"]; !ok {
+		s.BackendReconnectInitialDelay = 1
+	}
+	if _, ok := ctx.Settings()["backendReconnectMaxDelay"]; !ok {
+		s.BackendReconnectMaxDelay = 10
+	}
+	if _, ok := ctx.Settings()["reconnectTimeout"]; !ok {
+		s.ReconnectTimeout = 30
+	}
+	if _, ok := ctx.Settings()["reconnectBufferSize"]; !ok {
+		s.ReconnectBufferSize = 1 << 20
+	}
+	if _, ok := ctx.Settings()["shadowPercentage"]; !ok {
+		s.ShadowPercentage = 100
+	}
+	if _, ok := ctx.Settings()["shadowQueueSize"]; !ok {
+		s.ShadowQueueSize = 100
+	}
+	if _, ok := ctx.Settings()["httpMethod"]; !ok {
+		s.HTTPMethod = http.MethodPost
+	}
+	if _, ok := ctx.Settings()["httpTimeout"]; !ok {
+		s.HTTPTimeout = 30
+	}
+	if _, ok := ctx.Settings()["httpConcurrency"]; !ok || s.HTTPConcurrency < 1 {
+		s.HTTPConcurrency = 1
+	}
+	if _, ok := ctx.Settings()["adminHost"]; !ok {
+		s.AdminHost = "localhost"
+	}
+
+	urls := []string{s.URI}
+	backends, err := coerce.ToArray(s.Backends)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backends - %s", err)
+	}
+	for _, u := range backends {
+		str, err := coerce.ToString(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backends entry [%v] - %s", u, err)
+		}
+		if str = strings.TrimSpace(str); str != "" {
+			urls = append(urls, str)
+		}
+	}
+	var isWSS bool
+	for _, u := range append(urls, s.ShadowURI) {
+		isWSS = isWSS || strings.HasPrefix(u, "wss") || strings.HasPrefix(u, "https")
+	}
+	for _, u := range urls {
+		if isHTTP(u) != isHTTP(s.URI) || isTCP(u) != isTCP(s.URI) {
+			return nil, fmt.Errorf("backend [%s] doesn't use the protocol of uri [%s], websocket, HTTP and TCP backends can't be mixed", u, s.URI)
+		}
+	}
+	balancer, err := newBalancer(urls, s.LoadBalancing, s.HashHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := *websocket.DefaultDialer
+	if isWSS {
+		tlsConf := &tlsconfig.Config{
+			AllowInsecure: s.AllowInsecure,
+			CaCert:        s.CaCert,
+			Cert:          s.ClientCert,
+			Key:           s.ClientKey,
+			Password:      s.CertPassword,
+			MinVersion:    s.MinTLSVersion,
+			MaxVersion:    s.MaxTLSVersion,
+			CipherSuites:  s.CipherSuites,
+		}
+		dialer.TLSClientConfig, err = tlsConf.ClientConfig(ctx.Logger())
+		if err != nil {
+			return nil, err
+		}
+	}
+	proxyConf := &proxyconfig.Config{
+		URL:      s.ProxyURL,
+		User:     s.ProxyUser,
+		Password: s.ProxyPassword,
+		NoProxy:  s.NoProxy,
+	}
+	dialer.Proxy, err = proxyConf.ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := newInterceptor(s.UpstreamInterceptor)
+	if err != nil {
+		return nil, err
+	}
+	downstream, err := newInterceptor(s.DownstreamInterceptor)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &Activity{settings: s, dialer: &dialer, balancer: balancer, upstream: upstream, downstream: downstream}
+	act.keepalive = &keepalive{
+		idleTimeout:    time.Duration(s.IdleTimeout) * time.Second,
+		maxLifetime:    time.Duration(s.MaxLifetime) * time.Second,
+		pingInterval:   time.Duration(s.PingInterval) * time.Second,
+		pongTimeout:    time.Duration(s.PongTimeout) * time.Second,
+		forwardControl: s.ForwardControlFrames,
+	}
+	if s.BackendReconnectAttempts != 0 {
+		act.resume = &resume{
+			attempts:     s.BackendReconnectAttempts,
+			initialDelay: time.Duration(s.BackendReconnectInitialDelay) * time.Second,
+			maxDelay:     time.Duration(s.BackendReconnectMaxDelay) * time.Second,
+			timeout:      time.Duration(s.ReconnectTimeout) * time.Second,
+			bufferSize:   s.ReconnectBufferSize,
+			message:      s.ResumeMessage,
+		}
+	}
+	if s.CompletionFlow != "" {
+		act.completion = &flow{uri: s.CompletionFlow}
+	}
+	act.tcp = isTCP(s.URI)
+	if isHTTP(s.URI) {
+		act.bridge = &bridge{
+			client:      httpClient(&dialer),
+			method:      strings.ToUpper(s.HTTPMethod),
+			concurrency: s.HTTPConcurrency,
+		}
+		act.bridge.client.Timeout = time.Duration(s.HTTPTimeout) * time.Second
+	}
+	if s.ShadowURI != "" {
+		act.shadow = &shadow{
+			uri:        s.ShadowURI,
+			percentage: s.ShadowPercentage,
+			compare:    s.ShadowCompare,
+			queueSize:  s.ShadowQueueSize,
+		}
+	}
+	if s.AdminPort > 0 {
+		act.adminAddr = net.JoinHostPort(s.AdminHost, strconv.Itoa(s.AdminPort))
+		err = startAdmin(act.adminAddr, ctx.Logger())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(urls) > 1 && s.HealthCheckInterval > 0 {
+		balancer.start(&dialer, backendHeaders(s, nil, nil), time.Duration(s.HealthCheckInterval)*time.Second,
+			time.Duration(s.HealthCheckTimeout)*time.Second, ctx.Logger())
+	}
 	return act, nil
 }
 
 // Activity is an activity that is used to invoke a Web socket operation
 // settings : {wsconnection, url, maxconnections}
 type Activity struct {
-	settings *Settings
+	settings   *Settings
+	dialer     *websocket.Dialer
+	balancer   *balancer
+	upstream   *interceptor
+	downstream *interceptor
+	keepalive  *keepalive
+	resume     *resume
+	shadow     *shadow
+	bridge     *bridge
+	tcp        bool
+	completion *flow
+	adminAddr  string
 }
 
 // Metadata returns the metadata for a websocket proxy
@@ -54,10 +259,26 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	input := &Input{}
 	ctx.GetInputObject(input)
 
+	clientConn := input.WSconnection.(*websocket.Conn)
+	request := requestHeader(input.Headers)
 	wspService := &WSProxy{
-		serviceName: ctx.Name(),
-		clientConn:  input.WSconnection.(*websocket.Conn),
-		backendURL:  a.settings.URI,
+		serviceName:  ctx.Name(),
+		clientConn:   clientConn,
+		balancer:     a.balancer,
+		dialer:       a.dialer,
+		request:      request,
+		header:       backendHeaders(a.settings, request, clientConn),
+		pathParams:   input.PathParams,
+		queryParams:  input.QueryParams,
+		forwardQuery: a.settings.ForwardQuery,
+		upstream:     a.upstream,
+		downstream:   a.downstream,
+		keepalive:    a.keepalive,
+		resume:       a.resume,
+		shadow:       a.shadow,
+		bridge:       a.bridge,
+		tcp:          a.tcp,
+		logger:       ctx.Logger(),
 	}
 	if a.settings.MaxConnections == "" {
 		wspService.maxConnections = defaultMaxConnections
@@ -68,7 +289,46 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		}
 	}
 
+	if a.settings.Mode == ModeSync {
+		out := a.proxy(wspService)
+		err = ctx.SetOutputObject(out)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
 	// start proxy client as a goroutine
-	go startProxyClient(wspService)
+	go a.proxy(wspService)
 	return true, nil
 }
+
+// proxy proxies the session until it ends and returns its stats, which are
+// handed to the completion flow as well
+func (a *Activity) proxy(wsp *WSProxy) *Output {
+	pc, err := startProxyClient(wsp)
+	out := &Output{}
+	if pc != nil {
+		wsp.logger.Debug(pc.status())
+		out = pc.output()
+	}
+	if err != nil {
+		wsp.logger.Warn(err)
+		out.Error = err.Error()
+	}
+	if a.completion != nil {
+		_, err = a.completion.run(out.ToMap())
+		if err != nil {
+			wsp.logger.Errorf("error while running completion flow - %s", err)
+		}
+	}
+	return out
+}
+
+// Cleanup stops the backend health checks and releases the admin endpoint
+func (a *Activity) Cleanup() error {
+	a.balancer.stop()
+	if a.adminAddr != "" {
+		return stopAdmin(a.adminAddr)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package wsproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/action"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoBackend returns the url of a websocket backend echoing every message
+func echoBackend(t *testing.T) string {
+	up := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			mt, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = c.WriteMessage(mt, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// newTestActivity creates the proxy activity with the supplied settings
+func newTestActivity(t *testing.T, settings map[string]interface{}) *Activity {
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { act.(*Activity).Cleanup() })
+	return act.(*Activity)
+}
+
+// gateway accepts websocket clients like the websocket trigger and hands the
+// accepted connections to proxy, it returns a connected client
+func gateway(t *testing.T, proxy func(conn *websocket.Conn)) *websocket.Conn {
+	up := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		proxy(c)
+	}))
+	t.Cleanup(s.Close)
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// evalSync evaluates the activity for every proxied connection, the contexts
+// are sent once Eval returned
+func evalSync(t *testing.T, a *Activity) (*websocket.Conn, <-chan *test.TestActivityContext) {
+	evaluated := make(chan *test.TestActivityContext, 1)
+	client := gateway(t, func(conn *websocket.Conn) {
+		ctx := test.NewActivityContext(a.Metadata())
+		ctx.TaskNameVal = t.Name()
+		ctx.SetInput("wsconnection", conn)
+		done, err := a.Eval(ctx)
+		assert.True(t, done)
+		assert.Nil(t, err)
+		evaluated <- ctx
+	})
+	return client, evaluated
+}
+
+// recorder is a flow action recording the inputs of its runs
+type recorder struct {
+	inputs chan map[string]interface{}
+}
+
+func (r *recorder) Metadata() *action.Metadata {
+	return &action.Metadata{}
+}
+
+func (r *recorder) IOMetadata() *metadata.IOMetadata {
+	return nil
+}
+
+func (r *recorder) Run(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	r.inputs <- inputs
+	return nil, nil
+}
+
+func TestEvalSync(t *testing.T) {
+	backend := echoBackend(t)
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "sync", "completionFlow": "res://flow:audit"})
+	completion := &recorder{inputs: make(chan map[string]interface{}, 1)}
+	a.completion.act = completion
+	a.completion.once.Do(func() {})
+	client, evaluated := evalSync(t, a)
+
+	for _, message := range []string{"hello", "world!"} {
+		assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte(message)))
+		_, echo, err := client.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, message, string(echo))
+	}
+	select {
+	case <-evaluated:
+		t.Fatal("Eval returned before the end of the session")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Nil(t, client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye")))
+
+	var ctx *test.TestActivityContext
+	select {
+	case ctx = <-evaluated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Eval didn't return after the end of the session")
+	}
+	out := &Output{}
+	assert.Nil(t, ctx.GetOutputObject(out))
+	assert.True(t, strings.HasPrefix(out.SessionID, t.Name()+"-"))
+	assert.Equal(t, backend, out.Backend)
+	assert.True(t, out.Duration >= 50, "duration %dms", out.Duration)
+	assert.Equal(t, int64(11), out.UpstreamBytes)
+	assert.Equal(t, int64(11), out.DownstreamBytes)
+	assert.Equal(t, int64(2), out.UpstreamMessages)
+	assert.Equal(t, int64(2), out.DownstreamMessages)
+	assert.Equal(t, websocket.CloseNormalClosure, out.CloseCode)
+	assert.Equal(t, "bye", out.CloseReason)
+	assert.Equal(t, ClosedByClient, out.ClosedBy)
+	assert.Equal(t, "", out.Error)
+
+	select {
+	case inputs := <-completion.inputs:
+		assert.Equal(t, out.ToMap(), inputs, "the completion flow gets the outputs")
+	case <-time.After(time.Second):
+		t.Fatal("completion flow didn't run")
+	}
+}
+
+func TestEvalSyncBackendDown(t *testing.T) {
+	a := newTestActivity(t, map[string]interface{}{"uri": "ws://127.0.0.1:1/ws", "mode": "Sync"})
+	_, evaluated := evalSync(t, a)
+
+	ctx := <-evaluated
+	out := &Output{}
+	assert.Nil(t, ctx.GetOutputObject(out))
+	assert.Equal(t, ClosedByProxy, out.ClosedBy)
+	assert.Equal(t, "failed to connect backend", out.CloseReason)
+	assert.Contains(t, out.Error, "failed to connect backend url[ws://127.0.0.1:1/ws]")
+}
@@ -0,0 +1,204 @@
+package wsproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+)
+
+// session is the admin view of a proxied session
+type session struct {
+	ID                 string    `json:"id"`
+	Backend            string    `json:"backend"`
+	StartTime          time.Time `json:"startTime"`
+	UpTime             string    `json:"upTime"`
+	UpstreamBytes      int64     `json:"upstreamBytes"`
+	DownstreamBytes    int64     `json:"downstreamBytes"`
+	UpstreamMessages   int64     `json:"upstreamMessages"`
+	DownstreamMessages int64     `json:"downstreamMessages"`
+	Reconnects         int64     `json:"reconnects"`
+}
+
+// service is the admin view of a proxy service
+type service struct {
+	Name           string     `json:"name"`
+	MaxConnections int        `json:"maxConnections"`
+	Sessions       []*session `json:"sessions"`
+}
+
+// adminServer is the admin endpoint shared by the proxy activities
+// configured with the same admin address
+type adminServer struct {
+	server *http.Server
+	refs   int
+}
+
+var adminServers = struct {
+	servers map[string]*adminServer
+	sync.Mutex
+}{servers: make(map[string]*adminServer)}
+
+// startAdmin starts the admin endpoint on the supplied address unless an
+// other proxy activity already started it
+func startAdmin(addr string, logger log.Logger) error {
+	adminServers.Lock()
+	defer adminServers.Unlock()
+	if admin := adminServers.servers[addr]; admin != nil {
+		admin.refs++
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin endpoint on [%s] - %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sessions", listSessions)
+	mux.HandleFunc("/sessions/terminate", terminateSession)
+	mux.HandleFunc("/metrics", writeMetrics)
+	admin := &adminServer{server: &http.Server{Handler: mux}, refs: 1}
+	adminServers.servers[addr] = admin
+	go func() {
+		err := admin.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorf("admin endpoint on [%s] failed - %s", addr, err)
+		}
+	}()
+	logger.Infof("wsproxy admin endpoint listening on [%s]", addr)
+	return nil
+}
+
+// stopAdmin stops the admin endpoint once no proxy activity uses it
+func stopAdmin(addr string) error {
+	adminServers.Lock()
+	defer adminServers.Unlock()
+	admin := adminServers.servers[addr]
+	if admin == nil {
+		return nil
+	}
+	admin.refs--
+	if admin.refs > 0 {
+		return nil
+	}
+	delete(adminServers.servers, addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return admin.server.Shutdown(ctx)
+}
+
+// listSessions lists the proxy services along with their active sessions
+func listSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	services := []*service{}
+	proxyServices.RLock()
+	for _, p := range proxyServices.services {
+		p.RLock()
+		svc := &service{Name: p.name, MaxConnections: p.maxConnections, Sessions: []*session{}}
+		for _, pc := range p.proxyclients {
+			svc.Sessions = append(svc.Sessions, pc.session())
+		}
+		p.RUnlock()
+		sort.Slice(svc.Sessions, func(i, j int) bool { return svc.Sessions[i].StartTime.Before(svc.Sessions[j].StartTime) })
+		services = append(services, svc)
+	}
+	proxyServices.RUnlock()
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services)
+}
+
+// terminateSession closes the session with the supplied id, the close code
+// defaults to 1001 (going away)
+func terminateSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	code := websocket.CloseGoingAway
+	if str := r.URL.Query().Get("code"); str != "" {
+		var err error
+		code, err = strconv.Atoi(str)
+		if err != nil || !validCloseCode(code) {
+			http.Error(w, fmt.Sprintf("invalid close code [%s]", str), http.StatusBadRequest)
+			return
+		}
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "terminated by administrator"
+	}
+
+	var pc *ProxyClient
+	proxyServices.RLock()
+	for _, p := range proxyServices.services {
+		p.RLock()
+		if pc == nil {
+			pc = p.proxyclients[id]
+		}
+		p.RUnlock()
+	}
+	proxyServices.RUnlock()
+	if pc == nil {
+		http.Error(w, fmt.Sprintf("session [%s] not found", id), http.StatusNotFound)
+		return
+	}
+	pc.terminate(code, reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMetrics writes the proxy metrics in the Prometheus text format
+func writeMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.write(w)
+}
+
+// validCloseCode reports whether the code may be sent in a close message
+func validCloseCode(code int) bool {
+	switch code {
+	case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData, websocket.ClosePolicyViolation,
+		websocket.CloseMessageTooBig, websocket.CloseMandatoryExtension, websocket.CloseInternalServerErr,
+		websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// session returns the admin view of the proxy client
+func (pc *ProxyClient) session() *session {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return &session{
+		ID:                 pc.name,
+		Backend:            pc.target,
+		StartTime:          pc.startTime,
+		UpTime:             pc.upTime().Round(time.Millisecond).String(),
+		UpstreamBytes:      atomic.LoadInt64(&pc.upstreamBytes),
+		DownstreamBytes:    atomic.LoadInt64(&pc.downstreamBytes),
+		UpstreamMessages:   atomic.LoadInt64(&pc.upstreamMessages),
+		DownstreamMessages: atomic.LoadInt64(&pc.downstreamMessages),
+		Reconnects:         atomic.LoadInt64(&pc.reconnects),
+	}
+}
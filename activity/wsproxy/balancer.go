@@ -0,0 +1,222 @@
+package wsproxy
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+)
+
+const (
+	// BalanceRoundRobin sends client sessions to the backends in turn
+	BalanceRoundRobin = "RoundRobin"
+	// BalanceLeastConnections sends client sessions to the backend with the
+	// fewest proxied sessions
+	BalanceLeastConnections = "LeastConnections"
+	// BalanceHash sends client sessions with the same hashHeader value to the
+	// same backend
+	BalanceHash = "Hash"
+)
+
+// replicas is the number of points of every backend on the hash ring
+const replicas = 100
+
+// backend is a backend websocket url along with its health
+type backend struct {
+	url     string
+	healthy bool
+	lastErr error
+}
+
+// balancer selects the backend of a client session according to the load
+// balancing strategy, backends which failed their health check are skipped
+// as long as a healthy one is available
+type balancer struct {
+	backends   []*backend
+	strategy   string
+	hashHeader string
+	ring       []uint32
+	points     map[uint32]*backend
+	next       int
+	checking   bool
+	done       chan struct{}
+	sync.Mutex
+}
+
+func newBalancer(urls []string, strategy, hashHeader string) (*balancer, error) {
+	b := &balancer{hashHeader: http.CanonicalHeaderKey(hashHeader), done: make(chan struct{})}
+	switch {
+	case strategy == "" || strings.EqualFold(strategy, BalanceRoundRobin):
+		b.strategy = BalanceRoundRobin
+	case strings.EqualFold(strategy, BalanceLeastConnections):
+		b.strategy = BalanceLeastConnections
+	case strings.EqualFold(strategy, BalanceHash):
+		b.strategy = BalanceHash
+		if hashHeader == "" {
+			return nil, fmt.Errorf("hashHeader is required with the %s load balancing strategy", BalanceHash)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported loadBalancing [%s]", strategy)
+	}
+	b.points = make(map[uint32]*backend)
+	for _, u := range urls {
+		be := &backend{url: u, healthy: true}
+		b.backends = append(b.backends, be)
+		for i := 0; i < replicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "-" + u))
+			if _, ok := b.points[point]; !ok {
+				b.points[point] = be
+				b.ring = append(b.ring, point)
+			}
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+	return b, nil
+}
+
+// pick returns the backend of a client session, counts are the sessions
+// currently proxied to every backend url and header the headers of the
+// original upgrade request. Backends in exclude already failed for the session
+func (b *balancer) pick(counts map[string]int, header http.Header, exclude map[*backend]bool) *backend {
+	b.Lock()
+	defer b.Unlock()
+	candidates := make(map[*backend]bool, len(b.backends))
+	for _, be := range b.backends {
+		if be.healthy && !exclude[be] {
+			candidates[be] = true
+		}
+	}
+	if len(candidates) == 0 {
+		// every backend is down, keep trying all of them
+		for _, be := range b.backends {
+			if !exclude[be] {
+				candidates[be] = true
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	switch b.strategy {
+	case BalanceLeastConnections:
+		var least *backend
+		for _, be := range b.backends {
+			if candidates[be] && (least == nil || counts[be.url] < counts[least.url]) {
+				least = be
+			}
+		}
+		return least
+	case BalanceHash:
+		if value := header.Get(b.hashHeader); value != "" {
+			point := crc32.ChecksumIEEE([]byte(value))
+			start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= point })
+			for i := 0; i < len(b.ring); i++ {
+				if be := b.points[b.ring[(start+i)%len(b.ring)]]; candidates[be] {
+					return be
+				}
+			}
+		}
+		// sessions without the header are spread in turn
+	}
+	for i := 0; i < len(b.backends); i++ {
+		be := b.backends[(b.next+i)%len(b.backends)]
+		if candidates[be] {
+			b.next = (b.next + i + 1) % len(b.backends)
+			return be
+		}
+	}
+	return nil
+}
+
+// setHealth records the result of a health check or connection attempt
+func (b *balancer) setHealth(be *backend, err error) {
+	b.Lock()
+	defer b.Unlock()
+	be.healthy = err == nil
+	be.lastErr = err
+}
+
+// start starts the health checks, without them backends are never skipped.
+// The probes carry the static headers so that backends requiring them answer
+func (b *balancer) start(dialer *websocket.Dialer, header http.Header, interval, timeout time.Duration, logger log.Logger) {
+	b.checking = true
+	go b.healthCheck(dialer, header, interval, timeout, logger)
+}
+
+// failure records a failed connection attempt, the backend is skipped until
+// it passes the next health check
+func (b *balancer) failure(be *backend, err error) {
+	if b.checking {
+		b.setHealth(be, err)
+	}
+}
+
+// healthCheck periodically opens a websocket connection to every backend,
+// backends which can't be connected to are skipped until they recover
+func (b *balancer) healthCheck(dialer *websocket.Dialer, header http.Header, interval, timeout time.Duration, logger log.Logger) {
+	probe := *dialer
+	probe.HandshakeTimeout = timeout
+	client := httpClient(dialer)
+	client.Timeout = timeout
+	tcpDialer := &net.Dialer{Timeout: timeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.done:
+			return
+		}
+		for _, be := range b.backends {
+			var err error
+			switch {
+			case isHTTP(be.url):
+				err = probeHTTP(client, be.url, header)
+			case isTCP(be.url):
+				if !strings.Contains(be.url, "{") {
+					err = probeTCP(be.url, tcpDialer)
+				}
+			default:
+				var conn *websocket.Conn
+				var res *http.Response
+				conn, res, err = probe.Dial(be.url, header)
+				if err == nil {
+					conn.Close()
+				} else if res != nil && strings.Contains(be.url, "{") {
+					// the placeholders of templated uris aren't filled, any
+					// response shows that the backend is up
+					err = nil
+				}
+			}
+			b.Lock()
+			healthy := be.healthy
+			b.Unlock()
+			switch {
+			case err != nil && healthy:
+				logger.Warnf("backend [%s] failed its health check - %s", be.url, err)
+			case err == nil && !healthy:
+				logger.Infof("backend [%s] recovered", be.url)
+			}
+			b.setHealth(be, err)
+		}
+	}
+}
+
+// stop stops the health checks
+func (b *balancer) stop() {
+	b.Lock()
+	defer b.Unlock()
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
@@ -0,0 +1,86 @@
+package wsproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b, err := newBalancer([]string{"ws://a", "ws://b", "ws://c"}, "", "")
+	assert.Nil(t, err)
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, b.pick(nil, nil, nil).url)
+	}
+	assert.Equal(t, []string{"ws://a", "ws://b", "ws://c", "ws://a"}, picked)
+
+	b.setHealth(b.backends[1], errors.New("down"))
+	assert.Equal(t, "ws://c", b.pick(nil, nil, nil).url)
+	assert.Equal(t, "ws://a", b.pick(nil, nil, nil).url, "unhealthy backends are skipped")
+	assert.Equal(t, "ws://c", b.pick(nil, nil, map[*backend]bool{b.backends[0]: true}).url)
+
+	_, err = newBalancer([]string{"ws://a"}, "Hash", "")
+	assert.NotNil(t, err, "hash strategy requires the header")
+}
+
+func TestBalancerLeastConnections(t *testing.T) {
+	b, _ := newBalancer([]string{"ws://a", "ws://b", "ws://c"}, "leastconnections", "")
+	counts := map[string]int{"ws://a": 2, "ws://b": 0, "ws://c": 1}
+	assert.Equal(t, "ws://b", b.pick(counts, nil, nil).url)
+	b.setHealth(b.backends[1], errors.New("down"))
+	assert.Equal(t, "ws://c", b.pick(counts, nil, nil).url)
+}
+
+func TestBalancerHash(t *testing.T) {
+	b, _ := newBalancer([]string{"ws://a", "ws://b", "ws://c"}, "Hash", "x-user")
+	header := http.Header{"X-User": {"alice"}}
+	first := b.pick(nil, header, nil)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, b.pick(nil, header, nil), "same header value selects the same backend")
+	}
+	b.setHealth(first, errors.New("down"))
+	next := b.pick(nil, header, nil)
+	assert.NotEqual(t, first, next)
+	b.setHealth(first, nil)
+	assert.Equal(t, first, b.pick(nil, header, nil), "sessions move back once the backend recovered")
+
+	users := make(map[*backend]bool)
+	for _, user := range []string{"u1", "u2", "u3", "u4", "u5", "u6", "u7", "u8"} {
+		users[b.pick(nil, http.Header{"X-User": {user}}, nil)] = true
+	}
+	assert.True(t, len(users) > 1, "header values are spread across the backends")
+}
+
+func TestBalancerHealthCheckHeaders(t *testing.T) {
+	up := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		c, err := up.Upgrade(w, r, nil)
+		if err == nil {
+			c.Close()
+		}
+	}))
+	defer s.Close()
+	b, _ := newBalancer([]string{"ws" + strings.TrimPrefix(s.URL, "http"), "ws://127.0.0.1:1"}, "", "")
+	b.setHealth(b.backends[0], errors.New("down"))
+	header := http.Header{"Authorization": {"Bearer token"}}
+	b.start(websocket.DefaultDialer, header, 10*time.Millisecond, time.Second, log.RootLogger())
+	defer b.stop()
+
+	assert.Eventually(t, func() bool {
+		b.Lock()
+		defer b.Unlock()
+		return b.backends[0].healthy && !b.backends[1].healthy
+	}, 2*time.Second, 10*time.Millisecond, "the probe carries the static headers")
+}
@@ -0,0 +1,185 @@
+package wsproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// bridge is the configuration of HTTP backends: every client message is sent
+// as an HTTP request and the response body is written back to the client
+type bridge struct {
+	client      *http.Client
+	method      string
+	concurrency int
+}
+
+// isHTTP reports whether the backend uri selects the HTTP bridge
+func isHTTP(uri string) bool {
+	uri = strings.ToLower(uri)
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// selectHTTPBackend selects the HTTP backend of the session, HTTP backends
+// aren't connected up front, their failures surface with the first request
+func (p *ProxyService) selectHTTPBackend(pc *ProxyClient, wsp *WSProxy) error {
+	p.Lock()
+	be := p.balancer.pick(p.connections(), wsp.request, nil)
+	pc.backend = be
+	p.Unlock()
+	target, err := backendURL(be.url, wsp.pathParams, wsp.queryParams, wsp.forwardQuery)
+	if err != nil {
+		return err
+	}
+	pc.mu.Lock()
+	pc.target = target
+	pc.mu.Unlock()
+	return nil
+}
+
+// request sends a client message to the HTTP backend, at most concurrency
+// requests of the session are in flight. With a single one the responses
+// keep the order of the messages
+func (pc *ProxyClient) request(mt int, message []byte) error {
+	select {
+	case pc.slots <- struct{}{}:
+	case <-pc.ctx.Done():
+		return pc.ctx.Err()
+	}
+	go func() {
+		defer func() { <-pc.slots }()
+		err := pc.exchange(mt, message)
+		if err != nil && pc.ctx.Err() == nil {
+			pc.bridgeFailed(err)
+		}
+	}()
+	return nil
+}
+
+// exchange sends one request and writes the response body to the client,
+// empty bodies aren't written. Failed requests and server errors are reported
+// to the load balancer like failed websocket connections
+func (pc *ProxyClient) exchange(mt int, message []byte) error {
+	req, err := http.NewRequest(pc.bridge.method, pc.target, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(pc.ctx)
+	for name, values := range pc.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", requestType(mt, message))
+	res, err := pc.bridge.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("request to backend url[%s] failed - %s", pc.target, err)
+		if pc.ctx.Err() == nil {
+			pc.balancer.failure(pc.backend, err)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		// the response is still forwarded, the backend is skipped by new sessions
+		pc.balancer.failure(pc.backend, fmt.Errorf("backend url[%s] answered %s", pc.target, res.Status))
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of backend url[%s] - %s", pc.target, err)
+	}
+	pc.active()
+	if len(body) == 0 {
+		return nil
+	}
+	if pc.mirror != nil {
+		pc.mirror.record(false, body)
+	}
+	rmt := responseType(res.Header.Get("Content-Type"), mt)
+	body, forward, err := pc.intercept(pc.downstream, DirectionDownstream, rmt, body)
+	if err != nil || !forward {
+		return err
+	}
+	err = pc.writeClient(rmt, body)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&pc.downstreamBytes, int64(len(body)))
+	atomic.AddInt64(&pc.downstreamMessages, 1)
+	return nil
+}
+
+// bridgeFailed closes the session after a failed request, the backend is
+// recorded as initiator
+func (pc *ProxyClient) bridgeFailed(err error) {
+	closeErr := &websocket.CloseError{Code: websocket.CloseInternalServerErr, Text: "backend request failed"}
+	if !pc.closing() {
+		pc.ended(ClosedByBackend, closeErr)
+		writeControl(pc.clientConn, websocket.CloseMessage, string(websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)))
+	}
+	select {
+	case pc.downstreamErr <- err:
+	default:
+	}
+}
+
+// requestType returns the content type of a client message, JSON text
+// messages are sent as application/json
+func requestType(mt int, message []byte) string {
+	if mt == websocket.BinaryMessage {
+		return "application/octet-stream"
+	}
+	if json.Valid(message) {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// responseType returns the message type of a response body, textual content
+// types are sent as text messages, without content type the type of the
+// client message is kept
+func responseType(contentType string, mt int) int {
+	if contentType == "" {
+		return mt
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return mt
+	}
+	if strings.HasPrefix(media, "text/") || strings.HasSuffix(media, "json") || strings.HasSuffix(media, "xml") ||
+		media == "application/javascript" || media == "application/x-www-form-urlencoded" {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// probeHTTP checks an HTTP backend, any response shows that it is up
+func probeHTTP(client *http.Client, uri string, header http.Header) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// httpClient returns the client of HTTP backends, it shares the TLS and
+// proxy configuration of the websocket dialer
+func httpClient(dialer *websocket.Dialer) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           dialer.Proxy,
+		TLSClientConfig: dialer.TLSClientConfig,
+	}}
+}
@@ -0,0 +1,155 @@
+package wsproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHTTP(t *testing.T) {
+	assert.True(t, isHTTP("http://localhost:8080/api"))
+	assert.True(t, isHTTP("HTTPS://localhost/api"))
+	assert.False(t, isHTTP("ws://localhost/ws"))
+	assert.False(t, isHTTP("wss://localhost/ws"))
+}
+
+func TestRequestType(t *testing.T) {
+	assert.Equal(t, "application/json", requestType(websocket.TextMessage, []byte(`{"a":1}`)))
+	assert.Equal(t, "text/plain; charset=utf-8", requestType(websocket.TextMessage, []byte("hello")))
+	assert.Equal(t, "application/octet-stream", requestType(websocket.BinaryMessage, []byte(`{"a":1}`)))
+}
+
+func TestResponseType(t *testing.T) {
+	assert.Equal(t, websocket.TextMessage, responseType("application/json; charset=utf-8", websocket.BinaryMessage))
+	assert.Equal(t, websocket.TextMessage, responseType("text/html", websocket.BinaryMessage))
+	assert.Equal(t, websocket.TextMessage, responseType("application/problem+xml", websocket.BinaryMessage))
+	assert.Equal(t, websocket.BinaryMessage, responseType("image/png", websocket.TextMessage))
+	assert.Equal(t, websocket.BinaryMessage, responseType("", websocket.BinaryMessage), "the type of the client message is kept")
+}
+
+func TestExchangeFailure(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	b, _ := newBalancer([]string{s.URL}, "", "")
+	b.checking = true
+	pc := &ProxyClient{
+		bridge:     &bridge{client: http.DefaultClient, method: http.MethodPost, concurrency: 1},
+		balancer:   b,
+		backend:    b.backends[0],
+		target:     s.URL,
+		ctx:        context.Background(),
+		clientConn: connPair(t),
+	}
+	assert.Nil(t, pc.exchange(websocket.TextMessage, []byte("hello")), "server errors are forwarded to the client")
+	assert.False(t, b.backends[0].healthy, "server errors are reported")
+
+	b.setHealth(b.backends[0], nil)
+	s.Close()
+	assert.NotNil(t, pc.exchange(websocket.TextMessage, []byte("hello")))
+	assert.False(t, b.backends[0].healthy, "failed requests are reported")
+}
+
+// httpBackend returns the url of an HTTP backend answering every request
+// with the prefixed request body after waiting for wait
+func httpBackend(t *testing.T, wait func(body string)) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		wait(string(body))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestBridgeOrder(t *testing.T) {
+	backend := httpBackend(t, func(body string) {
+		// the first message is answered last unless requests are serialized
+		if body == "one" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "Sync", "httpMethod": "put"})
+	client, evaluated := evalSync(t, a)
+
+	for _, message := range []string{"one", "two", "three"} {
+		assert.Nil(t, client.WriteMessage(websocket.BinaryMessage, []byte(message)))
+	}
+	for _, message := range []string{"one", "two", "three"} {
+		mt, response, err := client.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, "PUT "+message, string(response))
+	}
+	client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	out := &Output{}
+	(<-evaluated).GetOutputObject(out)
+	assert.Equal(t, int64(3), out.UpstreamMessages)
+	assert.Equal(t, int64(3), out.DownstreamMessages)
+	assert.Equal(t, int64(len("PUT one")+len("PUT two")+len("PUT three")), out.DownstreamBytes)
+}
+
+func TestBridgeConcurrency(t *testing.T) {
+	var inFlight int32
+	backend := httpBackend(t, func(body string) {
+		// every request waits until all of them are in flight
+		atomic.AddInt32(&inFlight, 1)
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&inFlight) < 3 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "Sync", "httpConcurrency": 3})
+	client, evaluated := evalSync(t, a)
+
+	start := time.Now()
+	for _, message := range []string{"one", "two", "three"} {
+		assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte(message)))
+	}
+	var responses []string
+	for i := 0; i < 3; i++ {
+		_, response, err := client.ReadMessage()
+		assert.Nil(t, err)
+		responses = append(responses, string(response))
+	}
+	assert.True(t, time.Since(start) < time.Second, "requests are sent concurrently")
+	assert.ElementsMatch(t, []string{"POST one", "POST two", "POST three"}, responses)
+	client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	<-evaluated
+}
+
+func TestBridgeFailed(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// drop the connection without response
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			c.Close()
+		}
+	}))
+	defer s.Close()
+	a := newTestActivity(t, map[string]interface{}{"uri": s.URL, "mode": "Sync"})
+	client, evaluated := evalSync(t, a)
+
+	assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, _, err := client.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if assert.True(t, ok, "unexpected error %v", err) {
+		assert.Equal(t, websocket.CloseInternalServerErr, closeErr.Code)
+		assert.Equal(t, "backend request failed", closeErr.Text)
+	}
+	out := &Output{}
+	(<-evaluated).GetOutputObject(out)
+	assert.Equal(t, ClosedByBackend, out.ClosedBy)
+	assert.Equal(t, websocket.CloseInternalServerErr, out.CloseCode)
+	assert.True(t, strings.Contains(out.Error, "request to backend url"), "error %s", out.Error)
+}
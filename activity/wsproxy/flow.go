@@ -0,0 +1,42 @@
+package wsproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/project-flogo/core/action"
+	"github.com/project-flogo/core/engine/runner"
+)
+
+// flowRef is the ref of the flow action running interceptor and completion flows
+const flowRef = "github.com/project-flogo/flow"
+
+// flow is a flow run by the proxy, it is created on first use once the flow
+// action is initialized
+type flow struct {
+	uri  string
+	act  action.Action
+	once sync.Once
+	err  error
+}
+
+// run runs the flow with the supplied inputs and returns its outputs
+func (f *flow) run(inputs map[string]interface{}) (map[string]interface{}, error) {
+	f.once.Do(func() {
+		factory := action.GetFactory(flowRef)
+		if factory == nil {
+			f.err = fmt.Errorf("flow action isn't available to run flow [%s]", f.uri)
+			return
+		}
+		f.act, f.err = factory.New(&action.Config{Ref: flowRef, Settings: map[string]interface{}{"flowURI": f.uri}})
+	})
+	if f.err != nil {
+		return nil, f.err
+	}
+	outputs, err := runner.NewDirect().RunAction(context.Background(), f.act, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("error while running flow [%s] - %s", f.uri, err)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,102 @@
+package wsproxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// handshakeHeaders are set by the dialer itself, they are never passed through
+var handshakeHeaders = map[string]bool{
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Host":                     true,
+	"Content-Length":           true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Accept":     true,
+}
+
+// requestHeader converts the headers input holding the headers of the
+// original upgrade request
+func requestHeader(request map[string]interface{}) http.Header {
+	received := make(http.Header, len(request))
+	for name, value := range request {
+		received[http.CanonicalHeaderKey(name)] = headerValues(value)
+	}
+	return received
+}
+
+// backendHeaders builds the headers of the backend handshake from the
+// configured static headers, the pass-through headers of the original upgrade
+// request and the X-Forwarded-For/X-Forwarded-Proto headers describing the client
+func backendHeaders(s *Settings, received http.Header, clientConn *websocket.Conn) http.Header {
+	header := make(http.Header)
+	passAll := strings.TrimSpace(s.PassThroughHeaders) == "*"
+	if passAll {
+		for name, values := range received {
+			header[name] = values
+		}
+	} else {
+		for _, name := range strings.Split(s.PassThroughHeaders, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if values, ok := received[name]; ok && name != "" {
+				header[name] = values
+			}
+		}
+	}
+	for name := range header {
+		if handshakeHeaders[name] {
+			delete(header, name)
+		}
+	}
+	// static headers override the passed through ones
+	for name, value := range s.Headers {
+		header.Set(name, value)
+	}
+	if s.ForwardedHeaders && clientConn != nil {
+		forwardedFor := received.Get("X-Forwarded-For")
+		if host, _, err := net.SplitHostPort(clientConn.RemoteAddr().String()); err == nil {
+			if forwardedFor != "" {
+				forwardedFor += ", "
+			}
+			forwardedFor += host
+		}
+		if forwardedFor != "" {
+			header.Set("X-Forwarded-For", forwardedFor)
+		}
+		// keep the protocol reported by a load balancer in front of the gateway
+		proto := received.Get("X-Forwarded-Proto")
+		if proto == "" {
+			proto = "http"
+			if _, ok := clientConn.UnderlyingConn().(*tls.Conn); ok {
+				proto = "https"
+			}
+		}
+		header.Set("X-Forwarded-Proto", proto)
+	}
+	return header
+}
+
+// headerValues converts a header value of the trigger output, repeating
+// headers are arrays
+func headerValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			s, _ := coerce.ToString(e)
+			values = append(values, s)
+		}
+		return values
+	}
+	s, _ := coerce.ToString(value)
+	return []string{s}
+}
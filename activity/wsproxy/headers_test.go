@@ -0,0 +1,33 @@
+package wsproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendHeaders(t *testing.T) {
+	s := &Settings{
+		Headers:            map[string]string{"X-Gateway": "flogo", "X-Tenant": "static"},
+		PassThroughHeaders: "authorization, X-Tenant, Connection",
+		ForwardedHeaders:   true,
+	}
+	request := map[string]interface{}{
+		"authorization":   "Bearer abc",
+		"X-Tenant":        "from-client",
+		"Connection":      "Upgrade",
+		"Cookie":          "session=1",
+		"X-Forwarded-For": "10.0.0.1",
+	}
+	header := backendHeaders(s, requestHeader(request), nil)
+	assert.Equal(t, "Bearer abc", header.Get("Authorization"))
+	assert.Equal(t, "static", header.Get("X-Tenant"), "static headers override pass-through headers")
+	assert.Equal(t, "flogo", header.Get("X-Gateway"))
+	assert.Empty(t, header.Get("Connection"), "handshake headers are never passed through")
+	assert.Empty(t, header.Get("Cookie"))
+
+	s.PassThroughHeaders = "*"
+	header = backendHeaders(s, requestHeader(map[string]interface{}{"Cookie": []interface{}{"a=1", "b=2"}, "Upgrade": "websocket"}), nil)
+	assert.Equal(t, []string{"a=1", "b=2"}, header["Cookie"])
+	assert.Empty(t, header.Get("Upgrade"))
+}
@@ -0,0 +1,178 @@
+package wsproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/data/expression"
+	_ "github.com/project-flogo/core/data/expression/script"
+	"github.com/project-flogo/core/data/resolve"
+)
+
+const (
+	// DirectionUpstream is the direction of messages from the client to the backend
+	DirectionUpstream = "upstream"
+	// DirectionDownstream is the direction of messages from the backend to the client
+	DirectionDownstream = "downstream"
+)
+
+const (
+	// InterceptPass forwards the message unchanged
+	InterceptPass = "Pass"
+	// InterceptModify forwards the message returned by the interceptor
+	InterceptModify = "Modify"
+	// InterceptDrop discards the message
+	InterceptDrop = "Drop"
+	// InterceptClose closes the session
+	InterceptClose = "Close"
+)
+
+// verdict is the decision of an interceptor about a message
+type verdict struct {
+	action  string
+	message []byte
+	reason  string
+}
+
+// interceptor hands every message of one direction to a flow or evaluates an
+// expression with it, the result decides whether the message is passed on,
+// modified, dropped or the session is closed
+type interceptor struct {
+	flow *flow
+	expr expression.Expr
+}
+
+// newInterceptor returns nil when no interceptor is configured, "res://" uris
+// select a flow, anything else is an expression
+func newInterceptor(config string) (*interceptor, error) {
+	config = strings.TrimSpace(config)
+	if config == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(config, "res://") {
+		return &interceptor{flow: &flow{uri: config}}, nil
+	}
+	expr, err := expression.NewFactory(resolve.GetBasicResolver()).NewExpr(strings.TrimPrefix(config, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid interceptor expression [%s] - %s", config, err)
+	}
+	return &interceptor{expr: expr}, nil
+}
+
+// intercept runs the interceptor for a message of the session
+func (i *interceptor) intercept(session, direction string, mt int, message []byte) (*verdict, error) {
+	values := map[string]interface{}{
+		"sessionId":   session,
+		"direction":   direction,
+		"messageType": messageType(mt),
+		"message":     content(mt, message),
+	}
+	if i.expr != nil {
+		result, err := i.expr.Eval(data.NewSimpleScope(values, nil))
+		if err != nil {
+			return nil, fmt.Errorf("error while evaluating interceptor expression - %s", err)
+		}
+		return exprVerdict(result, message)
+	}
+	outputs, err := i.flow.run(values)
+	if err != nil {
+		return nil, err
+	}
+	return toVerdict(outputs, message)
+}
+
+// exprVerdict interprets the result of an interceptor expression: an object
+// with an action like the outputs of interceptor flows, a boolean passing or
+// dropping the message, or any other value replacing the message
+func exprVerdict(result interface{}, message []byte) (*verdict, error) {
+	switch r := result.(type) {
+	case nil:
+		return &verdict{action: InterceptPass, message: message}, nil
+	case bool:
+		if r {
+			return &verdict{action: InterceptPass, message: message}, nil
+		}
+		return &verdict{action: InterceptDrop}, nil
+	case map[string]interface{}:
+		if _, ok := r["action"]; ok {
+			return toVerdict(r, message)
+		}
+	}
+	modified, err := toMessage(result)
+	if err != nil {
+		return nil, err
+	}
+	return &verdict{action: InterceptModify, message: modified}, nil
+}
+
+// toVerdict interprets the action, the modified message and the close reason
+// returned by an interceptor, without an action the message is passed on
+func toVerdict(result map[string]interface{}, message []byte) (*verdict, error) {
+	v := &verdict{action: InterceptPass, message: message}
+	str, _ := coerce.ToString(result["action"])
+	switch {
+	case str == "" || strings.EqualFold(str, InterceptPass):
+	case strings.EqualFold(str, InterceptModify):
+		v.action = InterceptModify
+		modified, err := toMessage(result["message"])
+		if err != nil {
+			return nil, err
+		}
+		v.message = modified
+	case strings.EqualFold(str, InterceptDrop):
+		v.action = InterceptDrop
+	case strings.EqualFold(str, InterceptClose):
+		v.action = InterceptClose
+		v.reason, _ = coerce.ToString(result["reason"])
+	default:
+		return nil, fmt.Errorf("unsupported interceptor action [%s]", str)
+	}
+	return v, nil
+}
+
+// content converts a message for the interceptor, JSON text messages are
+// decoded and binary messages are passed as bytes
+func content(mt int, message []byte) interface{} {
+	if mt == websocket.BinaryMessage {
+		return message
+	}
+	var decoded interface{}
+	if json.Unmarshal(message, &decoded) == nil {
+		if _, ok := decoded.(map[string]interface{}); ok {
+			return decoded
+		}
+		if _, ok := decoded.([]interface{}); ok {
+			return decoded
+		}
+	}
+	return string(message)
+}
+
+// toMessage converts a modified message to its wire format, objects and
+// arrays are sent as JSON
+func toMessage(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case map[string]interface{}, []interface{}:
+		return json.Marshal(v)
+	}
+	str, err := coerce.ToString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modified message - %s", err)
+	}
+	return []byte(str), nil
+}
+
+func messageType(mt int) string {
+	if mt == websocket.BinaryMessage {
+		return "Binary"
+	}
+	return "Text"
+}
@@ -0,0 +1,49 @@
+package wsproxy
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptorExpression(t *testing.T) {
+	i, err := newInterceptor(`=$.message.type != "admin"`)
+	assert.Nil(t, err)
+	v, err := i.intercept("s1", DirectionUpstream, websocket.TextMessage, []byte(`{"type":"chat"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, InterceptPass, v.action)
+	assert.Equal(t, `{"type":"chat"}`, string(v.message))
+	v, _ = i.intercept("s1", DirectionUpstream, websocket.TextMessage, []byte(`{"type":"admin"}`))
+	assert.Equal(t, InterceptDrop, v.action)
+
+	i, _ = newInterceptor(`=$.direction + ":" + $.message`)
+	v, _ = i.intercept("s1", DirectionDownstream, websocket.TextMessage, []byte("hello"))
+	assert.Equal(t, InterceptModify, v.action)
+	assert.Equal(t, "downstream:hello", string(v.message))
+
+	i, err = newInterceptor("")
+	assert.Nil(t, i)
+	assert.Nil(t, err)
+}
+
+func TestInterceptorVerdict(t *testing.T) {
+	v, err := toVerdict(map[string]interface{}{"action": "modify", "message": map[string]interface{}{"a": 1}}, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, InterceptModify, v.action)
+	assert.Equal(t, `{"a":1}`, string(v.message))
+
+	v, _ = toVerdict(map[string]interface{}{"action": "Close", "reason": "forbidden"}, []byte("x"))
+	assert.Equal(t, InterceptClose, v.action)
+	assert.Equal(t, "forbidden", v.reason)
+
+	v, _ = toVerdict(map[string]interface{}{}, []byte("x"))
+	assert.Equal(t, InterceptPass, v.action, "flows without an action pass the message")
+
+	_, err = toVerdict(map[string]interface{}{"action": "Reject"}, []byte("x"))
+	assert.NotNil(t, err)
+
+	v, _ = exprVerdict(map[string]interface{}{"text": "redacted"}, []byte("x"))
+	assert.Equal(t, InterceptModify, v.action, "objects without an action replace the message")
+	assert.Equal(t, `{"text":"redacted"}`, string(v.message))
+}
@@ -0,0 +1,122 @@
+package wsproxy
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepalivePayload is the payload of the pings sent by the proxy itself, their
+// pongs are never forwarded
+const keepalivePayload = "wsproxy-keepalive"
+
+// keepalive holds the session timeouts and the handling of control frames
+type keepalive struct {
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+	pingInterval   time.Duration
+	pongTimeout    time.Duration
+	forwardControl bool
+}
+
+// enabled reports whether the sessions need to be watched
+func (k *keepalive) enabled() bool {
+	return k.idleTimeout > 0 || k.maxLifetime > 0 || k.pingInterval > 0
+}
+
+// handleControl sets the ping and pong handlers of both legs of the session,
+// pings and pongs are forwarded to the other leg with forwardControl, else
+// pings are answered by the proxy
+func (pc *ProxyClient) handleControl(k *keepalive) {
+	pc.controlHandlers(pc.clientConn, pc.backendConn, k)
+	if conn := pc.backendConn(); conn != nil {
+		pc.controlHandlers(conn, pc.client, k)
+	}
+}
+
+// controlHandlers sets the ping and pong handlers of one leg, to returns the
+// other leg, which changes when the backend reconnects
+func (pc *ProxyClient) controlHandlers(from *websocket.Conn, to func() *websocket.Conn, k *keepalive) {
+	pc.extend(from, k)
+	from.SetPingHandler(func(data string) error {
+		pc.extend(from, k)
+		if k.forwardControl {
+			writeControl(to(), websocket.PingMessage, data)
+			return nil
+		}
+		writeControl(from, websocket.PongMessage, data)
+		return nil
+	})
+	from.SetPongHandler(func(data string) error {
+		pc.extend(from, k)
+		if k.forwardControl && data != keepalivePayload {
+			writeControl(to(), websocket.PongMessage, data)
+		}
+		return nil
+	})
+}
+
+// extend moves the read deadline of a leg when the proxy sends keepalive
+// pings, a leg which doesn't answer them in time is considered dead
+func (pc *ProxyClient) extend(conn *websocket.Conn, k *keepalive) {
+	if k.pingInterval > 0 {
+		conn.SetReadDeadline(time.Now().Add(k.pingInterval + k.pongTimeout))
+	}
+}
+
+// active records a data message of the session for the idle timeout
+func (pc *ProxyClient) active() {
+	atomic.StoreInt64(&pc.lastActivity, time.Now().UnixNano())
+}
+
+// watch sends the keepalive pings and terminates the session when it is idle
+// or reached its maximum lifetime, until done is closed
+func (pc *ProxyClient) watch(k *keepalive, done <-chan struct{}) {
+	var ping, idle, lifetime <-chan time.Time
+	if k.pingInterval > 0 {
+		ticker := time.NewTicker(k.pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	var idleTimer *time.Timer
+	if k.idleTimeout > 0 {
+		idleTimer = time.NewTimer(k.idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	if k.maxLifetime > 0 {
+		timer := time.NewTimer(k.maxLifetime - time.Since(pc.startTime))
+		defer timer.Stop()
+		lifetime = timer.C
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping:
+			writeControl(pc.clientConn, websocket.PingMessage, keepalivePayload)
+			writeControl(pc.backendConn(), websocket.PingMessage, keepalivePayload)
+		case <-idle:
+			last := time.Unix(0, atomic.LoadInt64(&pc.lastActivity))
+			if remaining := k.idleTimeout - time.Since(last); remaining > 0 {
+				idleTimer.Reset(remaining)
+				continue
+			}
+			pc.terminate(websocket.CloseGoingAway, "idle timeout")
+			return
+		case <-lifetime:
+			pc.terminate(websocket.CloseGoingAway, "maximum session lifetime reached")
+			return
+		}
+	}
+}
+
+// writeControl sends a control frame, failures surface on the next read of
+// the connection. HTTP backends have no connection
+func writeControl(conn *websocket.Conn, mt int, data string) {
+	if conn == nil {
+		return
+	}
+	conn.WriteControl(mt, []byte(data), time.Now().Add(time.Second))
+}
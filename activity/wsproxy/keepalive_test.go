@@ -0,0 +1,68 @@
+package wsproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// connPair returns the client end of a websocket connection to a server
+// which discards everything it receives
+func connPair(t *testing.T) *websocket.Conn {
+	up := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	assert.Nil(t, err)
+	return c
+}
+
+func TestWatchIdleTimeout(t *testing.T) {
+	pc := &ProxyClient{startTime: time.Now(), clientConn: connPair(t), serverConn: connPair(t)}
+	pc.active()
+	done := make(chan struct{})
+	defer close(done)
+	go pc.watch(&keepalive{idleTimeout: 100 * time.Millisecond}, done)
+
+	time.Sleep(60 * time.Millisecond)
+	pc.active()
+	time.Sleep(60 * time.Millisecond)
+	pc.mu.Lock()
+	assert.Equal(t, "", pc.closedBy, "activity postpones the idle timeout")
+	pc.mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	assert.Equal(t, ClosedByProxy, pc.closedBy)
+	assert.Equal(t, websocket.CloseGoingAway, pc.closeCode)
+	assert.Equal(t, "idle timeout", pc.closeReason)
+}
+
+func TestWatchMaxLifetime(t *testing.T) {
+	pc := &ProxyClient{startTime: time.Now(), clientConn: connPair(t), serverConn: connPair(t)}
+	done := make(chan struct{})
+	defer close(done)
+	go pc.watch(&keepalive{maxLifetime: 50 * time.Millisecond}, done)
+
+	time.Sleep(150 * time.Millisecond)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	assert.Equal(t, "maximum session lifetime reached", pc.closeReason)
+	assert.True(t, pc.terminated)
+}
@@ -1,29 +1,178 @@
 package wsproxy
 
+import "github.com/project-flogo/core/data/coerce"
+
 // Settings are the settings for the websocket proxy
 type Settings struct {
-	URI            string `md:"uri,required"`
-	MaxConnections string `md:"maxconnections"`
+	URI                          string            `md:"uri,required"`
+	Mode                         string            `md:"mode"`
+	CompletionFlow               string            `md:"completionFlow"`
+	Backends                     interface{}       `md:"backends"`
+	LoadBalancing                string            `md:"loadBalancing"`
+	HashHeader                   string            `md:"hashHeader"`
+	HealthCheckInterval          int               `md:"healthCheckInterval"`
+	HealthCheckTimeout           int               `md:"healthCheckTimeout"`
+	MaxConnections               string            `md:"maxconnections"`
+	AllowInsecure                bool              `md:"allowInsecure"`
+	CaCert                       string            `md:"caCert"`
+	ClientCert                   string            `md:"clientCert"`
+	ClientKey                    string            `md:"clientKey"`
+	CertPassword                 string            `md:"certPassword"`
+	MinTLSVersion                string            `md:"minTLSVersion"`
+	MaxTLSVersion                string            `md:"maxTLSVersion"`
+	CipherSuites                 string            `md:"cipherSuites"`
+	ProxyURL                     string            `md:"proxyURL"`
+	ProxyUser                    string            `md:"proxyUser"`
+	ProxyPassword                string            `md:"proxyPassword"`
+	NoProxy                      string            `md:"noProxy"`
+	Headers                      map[string]string `md:"headers"`
+	PassThroughHeaders           string            `md:"passThroughHeaders"`
+	ForwardedHeaders             bool              `md:"forwardedHeaders"`
+	ForwardQuery                 bool              `md:"forwardQuery"`
+	UpstreamInterceptor          string            `md:"upstreamInterceptor"`
+	DownstreamInterceptor        string            `md:"downstreamInterceptor"`
+	IdleTimeout                  int               `md:"idleTimeout"`
+	MaxLifetime                  int               `md:"maxLifetime"`
+	PingInterval                 int               `md:"pingInterval"`
+	PongTimeout                  int               `md:"pongTimeout"`
+	ForwardControlFrames         bool              `md:"forwardControlFrames"`
+	BackendReconnectAttempts     int               `md:"backendReconnectAttempts"`
+	BackendReconnectInitialDelay int               `md:"backendReconnectInitialDelay"`
+	BackendReconnectMaxDelay     int               `md:"backendReconnectMaxDelay"`
+	ReconnectTimeout             int               `md:"reconnectTimeout"`
+	ReconnectBufferSize          int               `md:"reconnectBufferSize"`
+	ResumeMessage                string            `md:"resumeMessage"`
+	ShadowURI                    string            `md:"shadowURI"`
+	ShadowPercentage             int               `md:"shadowPercentage"`
+	ShadowCompare                bool              `md:"shadowCompare"`
+	ShadowQueueSize              int               `md:"shadowQueueSize"`
+	HTTPMethod                   string            `md:"httpMethod"`
+	HTTPTimeout                  int               `md:"httpTimeout"`
+	HTTPConcurrency              int               `md:"httpConcurrency"`
+	AdminPort                    int               `md:"adminPort"`
+	AdminHost                    string            `md:"adminHost"`
 }
 
 // Input is the input into the websocket proxy
 type Input struct {
-	WSconnection interface{} `md:"wsconnection,required"`
+	WSconnection interface{}            `md:"wsconnection,required"`
+	Headers      map[string]interface{} `md:"headers"`
+	PathParams   map[string]string      `md:"pathParams"`
+	QueryParams  map[string]interface{} `md:"queryParams"`
 }
 
 // ToMap converts the input into a map
 func (o *Input) ToMap() map[string]interface{} {
 	return map[string]interface{}{
 		"wsconnection": o.WSconnection,
+		"headers":      o.Headers,
+		"pathParams":   o.PathParams,
+		"queryParams":  o.QueryParams,
 	}
 }
 
 // FromMap converts the values from a map to a struct
-func (o *Input) FromMap(values map[string]interface{}) error {
+func (o *Input) FromMap(values map[string]interface{}) (err error) {
 	o.WSconnection = values["wsconnection"]
+	o.Headers, err = coerce.ToObject(values["headers"])
+	if err != nil {
+		return err
+	}
+	o.PathParams, err = coerce.ToParams(values["pathParams"])
+	if err != nil {
+		return err
+	}
+	o.QueryParams, err = coerce.ToObject(values["queryParams"])
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-// Output is the output of the websocket proxy
+// Output is the output of the websocket proxy, the stats of the proxied
+// session in Sync mode
 type Output struct {
+	SessionID          string `md:"sessionId"`
+	Backend            string `md:"backend"`
+	Duration           int64  `md:"duration"`
+	UpstreamBytes      int64  `md:"upstreamBytes"`
+	DownstreamBytes    int64  `md:"downstreamBytes"`
+	UpstreamMessages   int64  `md:"upstreamMessages"`
+	DownstreamMessages int64  `md:"downstreamMessages"`
+	Reconnects         int64  `md:"reconnects"`
+	CloseCode          int    `md:"closeCode"`
+	CloseReason        string `md:"closeReason"`
+	ClosedBy           string `md:"closedBy"`
+	Error              string `md:"error"`
+}
+
+// ToMap converts the output into a map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"sessionId":          o.SessionID,
+		"backend":            o.Backend,
+		"duration":           o.Duration,
+		"upstreamBytes":      o.UpstreamBytes,
+		"downstreamBytes":    o.DownstreamBytes,
+		"upstreamMessages":   o.UpstreamMessages,
+		"downstreamMessages": o.DownstreamMessages,
+		"reconnects":         o.Reconnects,
+		"closeCode":          o.CloseCode,
+		"closeReason":        o.CloseReason,
+		"closedBy":           o.ClosedBy,
+		"error":              o.Error,
+	}
+}
+
+// FromMap converts the values from a map to a struct
+func (o *Output) FromMap(values map[string]interface{}) (err error) {
+	o.SessionID, err = coerce.ToString(values["sessionId"])
+	if err != nil {
+		return err
+	}
+	o.Backend, err = coerce.ToString(values["backend"])
+	if err != nil {
+		return err
+	}
+	o.Duration, err = coerce.ToInt64(values["duration"])
+	if err != nil {
+		return err
+	}
+	o.UpstreamBytes, err = coerce.ToInt64(values["upstreamBytes"])
+	if err != nil {
+		return err
+	}
+	o.DownstreamBytes, err = coerce.ToInt64(values["downstreamBytes"])
+	if err != nil {
+		return err
+	}
+	o.UpstreamMessages, err = coerce.ToInt64(values["upstreamMessages"])
+	if err != nil {
+		return err
+	}
+	o.DownstreamMessages, err = coerce.ToInt64(values["downstreamMessages"])
+	if err != nil {
+		return err
+	}
+	o.Reconnects, err = coerce.ToInt64(values["reconnects"])
+	if err != nil {
+		return err
+	}
+	o.CloseCode, err = coerce.ToInt(values["closeCode"])
+	if err != nil {
+		return err
+	}
+	o.CloseReason, err = coerce.ToString(values["closeReason"])
+	if err != nil {
+		return err
+	}
+	o.ClosedBy, err = coerce.ToString(values["closedBy"])
+	if err != nil {
+		return err
+	}
+	o.Error, err = coerce.ToString(values["error"])
+	if err != nil {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,170 @@
+package wsproxy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serviceMetrics are the totals of the ended sessions of a proxy service, the
+// counters of active sessions are added when the metrics are collected
+type serviceMetrics struct {
+	sessions, rejected                   int64
+	upstreamBytes, downstreamBytes       int64
+	upstreamMessages, downstreamMessages int64
+	duration                             time.Duration
+	closedBy                             map[string]int64
+}
+
+// proxyMetrics holds the metrics of all proxy services, they are kept when
+// a proxy service is released
+type proxyMetrics struct {
+	services map[string]*serviceMetrics
+	sync.Mutex
+}
+
+var metrics = &proxyMetrics{services: make(map[string]*serviceMetrics)}
+
+func (m *proxyMetrics) service(name string) *serviceMetrics {
+	s := m.services[name]
+	if s == nil {
+		s = &serviceMetrics{closedBy: make(map[string]int64)}
+		m.services[name] = s
+	}
+	return s
+}
+
+// started counts a new session of the service
+func (m *proxyMetrics) started(name string) {
+	m.Lock()
+	defer m.Unlock()
+	m.service(name).sessions++
+}
+
+// rejected counts a session rejected because of maxConnections
+func (m *proxyMetrics) rejected(name string) {
+	m.Lock()
+	defer m.Unlock()
+	m.service(name).rejected++
+}
+
+// ended adds the counters of an ended session to the totals of the service
+func (m *proxyMetrics) ended(name string, pc *ProxyClient) {
+	m.Lock()
+	defer m.Unlock()
+	s := m.service(name)
+	s.upstreamBytes += atomic.LoadInt64(&pc.upstreamBytes)
+	s.downstreamBytes += atomic.LoadInt64(&pc.downstreamBytes)
+	s.upstreamMessages += atomic.LoadInt64(&pc.upstreamMessages)
+	s.downstreamMessages += atomic.LoadInt64(&pc.downstreamMessages)
+	pc.mu.Lock()
+	s.duration += pc.upTime()
+	if pc.closedBy != "" {
+		s.closedBy[pc.closedBy]++
+	}
+	pc.mu.Unlock()
+}
+
+// metric is a metric in the Prometheus text format along with its samples
+type metric struct {
+	name, help, kind string
+	samples          []string
+}
+
+func (m *metric) add(value interface{}, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel(labels[i+1])))
+	}
+	m.samples = append(m.samples, fmt.Sprintf("%s{%s} %v", m.name, strings.Join(pairs, ","), value))
+}
+
+// write writes the metrics of all proxy services in the Prometheus text format
+func (m *proxyMetrics) write(w io.Writer) {
+	active := &metric{name: "wsproxy_sessions_active", help: "Proxied sessions in progress", kind: "gauge"}
+	backends := &metric{name: "wsproxy_backend_sessions_active", help: "Proxied sessions in progress per backend", kind: "gauge"}
+	sessions := &metric{name: "wsproxy_sessions_total", help: "Proxied sessions", kind: "counter"}
+	rejected := &metric{name: "wsproxy_sessions_rejected_total", help: "Sessions rejected because maxConnections was reached", kind: "counter"}
+	closed := &metric{name: "wsproxy_sessions_closed_total", help: "Ended sessions by close initiator", kind: "counter"}
+	duration := &metric{name: "wsproxy_session_duration_seconds_total", help: "Total duration of the ended sessions", kind: "counter"}
+	bytes := &metric{name: "wsproxy_bytes_total", help: "Bytes proxied per direction", kind: "counter"}
+	messages := &metric{name: "wsproxy_messages_total", help: "Messages proxied per direction", kind: "counter"}
+
+	// the registry is locked first so that ended sessions are counted once
+	proxyServices.RLock()
+	defer proxyServices.RUnlock()
+	for _, p := range proxyServices.services {
+		p.RLock()
+	}
+	defer func() {
+		for _, p := range proxyServices.services {
+			p.RUnlock()
+		}
+	}()
+	m.Lock()
+	defer m.Unlock()
+
+	names := make(map[string]bool)
+	for name := range m.services {
+		names[name] = true
+	}
+	for name := range proxyServices.services {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		total := *m.service(name)
+		live := 0
+		perBackend := make(map[string]bool)
+		counts := make(map[string]int)
+		if p := proxyServices.services[name]; p != nil {
+			live = len(p.proxyclients)
+			for _, pc := range p.proxyclients {
+				total.upstreamBytes += atomic.LoadInt64(&pc.upstreamBytes)
+				total.downstreamBytes += atomic.LoadInt64(&pc.downstreamBytes)
+				total.upstreamMessages += atomic.LoadInt64(&pc.upstreamMessages)
+				total.downstreamMessages += atomic.LoadInt64(&pc.downstreamMessages)
+				if pc.backend != nil {
+					perBackend[pc.backend.url] = true
+					counts[pc.backend.url]++
+				}
+			}
+		}
+		active.add(live, "service", name)
+		for _, url := range sortedKeys(perBackend) {
+			backends.add(counts[url], "service", name, "backend", url)
+		}
+		sessions.add(total.sessions, "service", name)
+		rejected.add(total.rejected, "service", name)
+		for _, by := range []string{ClosedByClient, ClosedByBackend, ClosedByProxy} {
+			closed.add(total.closedBy[by], "service", name, "closed_by", by)
+		}
+		duration.add(total.duration.Seconds(), "service", name)
+		bytes.add(total.upstreamBytes, "service", name, "direction", DirectionUpstream)
+		bytes.add(total.downstreamBytes, "service", name, "direction", DirectionDownstream)
+		messages.add(total.upstreamMessages, "service", name, "direction", DirectionUpstream)
+		messages.add(total.downstreamMessages, "service", name, "direction", DirectionDownstream)
+	}
+	for _, mt := range []*metric{active, backends, sessions, rejected, closed, duration, bytes, messages} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", mt.name, mt.help, mt.name, mt.kind)
+		for _, sample := range mt.samples {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,38 @@
+package wsproxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := &proxyMetrics{services: make(map[string]*serviceMetrics)}
+	m.started("chat")
+	m.started("chat")
+	m.rejected("chat")
+	m.ended("chat", &ProxyClient{upstreamBytes: 10, downstreamBytes: 20, upstreamMessages: 1, downstreamMessages: 2, closedBy: ClosedByClient})
+
+	buf := &bytes.Buffer{}
+	m.write(buf)
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE wsproxy_sessions_total counter\n")
+	assert.Contains(t, out, `wsproxy_sessions_total{service="chat"} 2`)
+	assert.Contains(t, out, `wsproxy_sessions_rejected_total{service="chat"} 1`)
+	assert.Contains(t, out, `wsproxy_sessions_active{service="chat"} 0`)
+	assert.Contains(t, out, `wsproxy_sessions_closed_total{service="chat",closed_by="client"} 1`)
+	assert.Contains(t, out, `wsproxy_bytes_total{service="chat",direction="upstream"} 10`)
+	assert.Contains(t, out, `wsproxy_messages_total{service="chat",direction="downstream"} 2`)
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+}
+
+func TestValidCloseCode(t *testing.T) {
+	assert.True(t, validCloseCode(1000))
+	assert.True(t, validCloseCode(4000))
+	assert.False(t, validCloseCode(1005), "reserved codes can't be sent")
+	assert.False(t, validCloseCode(5000))
+}
@@ -0,0 +1,161 @@
+package wsproxy
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+)
+
+// shadowWriteTimeout bounds every write to the shadow backend
+const shadowWriteTimeout = 10 * time.Second
+
+// shadow is the configuration of traffic mirroring: the client messages of a
+// share of the sessions are copied to a shadow backend whose responses are
+// discarded
+type shadow struct {
+	uri        string
+	percentage int
+	compare    bool
+	queueSize  int
+}
+
+// sampled reports whether a new session is mirrored
+func (s *shadow) sampled() bool {
+	return s.percentage >= 100 || rand.Intn(100) < s.percentage
+}
+
+// mirror copies the client messages of a session to the shadow backend. It
+// never blocks or fails the session: messages are dropped when the shadow
+// backend is slow and mirroring stops when the shadow backend fails
+type mirror struct {
+	mirrored, dropped, responses int64
+	compared, mismatches         int64
+	failed                       int32
+	session                      string
+	shadow                       *shadow
+	queue                        chan buffered
+	primary, shadowed            [][]byte
+	logger                       log.Logger
+	sync.Mutex
+}
+
+func newMirror(session string, s *shadow, logger log.Logger) *mirror {
+	return &mirror{session: session, shadow: s, queue: make(chan buffered, s.queueSize), logger: logger}
+}
+
+// copy queues a client message for the shadow backend, it is dropped when
+// the queue is full
+func (m *mirror) copy(mt int, message []byte) {
+	if atomic.LoadInt32(&m.failed) == 1 {
+		return
+	}
+	select {
+	case m.queue <- buffered{mt: mt, message: message}:
+	default:
+		atomic.AddInt64(&m.dropped, 1)
+	}
+}
+
+// run connects the shadow backend and sends it the queued messages until
+// done is closed
+func (m *mirror) run(dialer *websocket.Dialer, target string, header http.Header, done <-chan struct{}) {
+	defer m.summary()
+	conn, _, err := dialer.Dial(target, header)
+	if err != nil {
+		atomic.StoreInt32(&m.failed, 1)
+		m.logger.Warnf("session [%s] isn't mirrored, failed to connect shadow backend [%s] - %s", m.session, target, err)
+		return
+	}
+	defer conn.Close()
+	go m.read(conn)
+	for {
+		select {
+		case <-done:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(time.Second))
+			return
+		case b := <-m.queue:
+			conn.SetWriteDeadline(time.Now().Add(shadowWriteTimeout))
+			err = conn.WriteMessage(b.mt, b.message)
+			if err != nil {
+				atomic.StoreInt32(&m.failed, 1)
+				m.logger.Warnf("mirroring of session [%s] stopped, shadow backend failed - %s", m.session, err)
+				return
+			}
+			atomic.AddInt64(&m.mirrored, 1)
+		}
+	}
+}
+
+// read discards the responses of the shadow backend after comparing them
+func (m *mirror) read(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(&m.responses, 1)
+		m.record(true, message)
+	}
+}
+
+// record pairs the responses of the backend and the shadow backend in the
+// order they arrive and logs the mismatches, responses without counterpart
+// are kept up to the queue size
+func (m *mirror) record(fromShadow bool, message []byte) {
+	if !m.shadow.compare {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if fromShadow {
+		m.shadowed = append(m.shadowed, message)
+	} else {
+		m.primary = append(m.primary, message)
+	}
+	for len(m.primary) > 0 && len(m.shadowed) > 0 {
+		p, s := m.primary[0], m.shadowed[0]
+		m.primary, m.shadowed = m.primary[1:], m.shadowed[1:]
+		m.compared++
+		if !bytes.Equal(p, s) {
+			m.mismatches++
+			m.logger.Infof("shadow response [%d] of session [%s] differs - backend: %s, shadow: %s",
+				m.compared, m.session, truncate(p), truncate(s))
+		}
+	}
+	if len(m.primary) > m.shadow.queueSize {
+		m.primary = m.primary[1:]
+	}
+	if len(m.shadowed) > m.shadow.queueSize {
+		m.shadowed = m.shadowed[1:]
+	}
+}
+
+// summary logs the mirroring stats of the session
+func (m *mirror) summary() {
+	m.Lock()
+	compared, mismatches := m.compared, m.mismatches
+	m.Unlock()
+	template := "session [%s] mirrored: [%d] messages, [%d] dropped, [%d] shadow responses, [%d] compared, [%d] mismatches"
+	args := []interface{}{m.session, atomic.LoadInt64(&m.mirrored), atomic.LoadInt64(&m.dropped),
+		atomic.LoadInt64(&m.responses), compared, mismatches}
+	if m.shadow.compare {
+		m.logger.Infof(template, args...)
+		return
+	}
+	m.logger.Debugf(template, args...)
+}
+
+// truncate shortens a message for logging
+func truncate(message []byte) string {
+	if len(message) > 256 {
+		return string(message[:256]) + "..."
+	}
+	return string(message)
+}
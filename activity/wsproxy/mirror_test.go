@@ -0,0 +1,42 @@
+package wsproxy
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorCopy(t *testing.T) {
+	m := newMirror("s", &shadow{queueSize: 2}, log.RootLogger())
+	m.copy(websocket.TextMessage, []byte("one"))
+	m.copy(websocket.TextMessage, []byte("two"))
+	m.copy(websocket.TextMessage, []byte("three"))
+	assert.Len(t, m.queue, 2)
+	assert.Equal(t, int64(1), m.dropped, "a full queue drops messages instead of blocking")
+
+	m.failed = 1
+	m.copy(websocket.TextMessage, []byte("four"))
+	assert.Equal(t, int64(1), m.dropped, "nothing is queued once the shadow backend failed")
+}
+
+func TestMirrorRecord(t *testing.T) {
+	m := newMirror("s", &shadow{compare: true, queueSize: 2}, log.RootLogger())
+	m.record(false, []byte("a"))
+	m.record(false, []byte("b"))
+	m.record(true, []byte("a"))
+	m.record(true, []byte("c"))
+	assert.Equal(t, int64(2), m.compared)
+	assert.Equal(t, int64(1), m.mismatches)
+
+	for i := 0; i < 5; i++ {
+		m.record(true, []byte("x"))
+	}
+	assert.Len(t, m.shadowed, 2, "responses without counterpart are bounded")
+}
+
+func TestShadowSampled(t *testing.T) {
+	assert.True(t, (&shadow{percentage: 100}).sampled())
+	assert.False(t, (&shadow{percentage: 0}).sampled())
+}
@@ -1,30 +1,75 @@
 package wsproxy
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/websocket/wslock"
+)
+
+const (
+	// ClosedByClient is the initiator of sessions closed by the client
+	ClosedByClient = "client"
+	// ClosedByBackend is the initiator of sessions closed by the backend
+	ClosedByBackend = "backend"
+	// ClosedByProxy is the initiator of sessions closed by the proxy itself
+	ClosedByProxy = "proxy"
 )
 
 // ProxyClient is proxy between client websocket connection and server websocket connection
 type ProxyClient struct {
-	name                           string
-	startTime                      time.Time
-	upstreamBytes, downstreamBytes int64
-	clientConn                     *websocket.Conn
-	serverConn                     *websocket.Conn
-	upstreamErr, downstreamErr     chan error
+	upstreamBytes, downstreamBytes       int64
+	upstreamMessages, downstreamMessages int64
+	lastActivity                         int64
+	reconnects                           int64
+	name                                 string
+	startTime                            time.Time
+	endTime                              time.Time
+	clientConn                           *websocket.Conn
+	serverConn                           *websocket.Conn
+	backend                              *backend
+	target                               string
+	upstream, downstream                 *interceptor
+	keepalive                            *keepalive
+	resume                               *resume
+	mirror                               *mirror
+	bridge                               *bridge
+	balancer                             *balancer
+	tcpConn                              net.Conn
+	tcpDone                              chan struct{}
+	header                               http.Header
+	slots                                chan struct{}
+	ctx                                  context.Context
+	dial                                 func() (*websocket.Conn, error)
+	buffer                               []buffered
+	bufferedBytes                        int
+	reconnecting                         bool
+	backendMu                            sync.Mutex
+	done                                 chan struct{}
+	logger                               log.Logger
+	upstreamErr, downstreamErr           chan error
+	closeCode                            int
+	closeReason                          string
+	closedBy                             string
+	terminated                           bool
+	mu                                   sync.Mutex
 }
 
 // ProxyService holds ongoing ProxyClient instances
 type ProxyService struct {
 	name           string
 	proxyclients   map[string]*ProxyClient
-	backendURL     string
+	balancer       *balancer
 	maxConnections int
+	dialer         *websocket.Dialer
 	sync.RWMutex
 }
 
@@ -39,9 +84,10 @@ func (p *ProxyService) CreateProxyClient(name string, conn *websocket.Conn) (*Pr
 		return nil, errors.New(errMessage)
 	}
 	if len(p.proxyclients) >= p.maxConnections {
+		metrics.rejected(p.name)
 		errMessage := fmt.Sprintf("proxy service[%s] utilized maximum[%d] allowed concurrent connections, can't accept any more connections", p.name, p.maxConnections)
 		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, errMessage)
-		conn.WriteMessage(websocket.CloseMessage, closeMessage)
+		wslock.WriteMessage(conn, websocket.CloseMessage, closeMessage)
 		conn.Close()
 		return nil, errors.New(errMessage)
 	}
@@ -52,16 +98,78 @@ func (p *ProxyService) CreateProxyClient(name string, conn *websocket.Conn) (*Pr
 		upstreamErr:   make(chan error, 1),
 		downstreamErr: make(chan error, 1),
 	}
+	pClient.lastActivity = pClient.startTime.UnixNano()
 	p.proxyclients[name] = pClient
+	metrics.started(p.name)
 
 	return pClient, nil
 }
 
+// connections returns the number of proxy clients connected to every
+// backend url, the service must be locked
+func (p *ProxyService) connections() map[string]int {
+	counts := make(map[string]int)
+	for _, pc := range p.proxyclients {
+		if pc.backend != nil {
+			counts[pc.backend.url]++
+		}
+	}
+	return counts
+}
+
+// connectBackend dials the websocket backend selected by the load balancer
+func (p *ProxyService) connectBackend(pc *ProxyClient, wsp *WSProxy) (*websocket.Conn, error) {
+	var conn *websocket.Conn
+	err := p.connect(pc, wsp, func(target string) (err error) {
+		conn, _, err = p.dialer.Dial(target, wsp.header)
+		if err == nil {
+			pc.mu.Lock()
+			pc.serverConn = conn
+			pc.mu.Unlock()
+		}
+		return err
+	})
+	return conn, err
+}
+
+// connect connects the backend selected by the load balancer with dial,
+// backends which can't be connected to are skipped in favour of the next one
+func (p *ProxyService) connect(pc *ProxyClient, wsp *WSProxy, dial func(target string) error) error {
+	failed := make(map[*backend]bool)
+	var lastErr error
+	for {
+		// the backend is assigned right away so that least connections
+		// counts sessions which are still connecting
+		p.Lock()
+		be := p.balancer.pick(p.connections(), wsp.request, failed)
+		pc.backend = be
+		p.Unlock()
+		if be == nil {
+			return lastErr
+		}
+		target, err := backendURL(be.url, wsp.pathParams, wsp.queryParams, wsp.forwardQuery)
+		if err != nil {
+			return err
+		}
+		err = dial(target)
+		if err == nil {
+			pc.mu.Lock()
+			pc.target = target
+			pc.mu.Unlock()
+			return nil
+		}
+		lastErr = fmt.Errorf("failed to connect backend url[%s] - %s", target, err)
+		p.balancer.failure(be, err)
+		failed[be] = true
+	}
+}
+
 // ReleaseProxyClient removes proxy client instance from proxy service
 func (p *ProxyService) ReleaseProxyClient(pc *ProxyClient) {
 	p.Lock()
 	defer p.Unlock()
 	delete(p.proxyclients, pc.name)
+	metrics.ended(p.name, pc)
 }
 
 // ProxyServices holds multiple ProxyService instances
@@ -77,7 +185,7 @@ var proxyServices = ProxyServices{
 
 // GetService returns proxy service corresponding to supplied name
 // it creates new service it doesn't exist already
-func (p *ProxyServices) GetService(name string, backendURL string, maxConnections int) *ProxyService {
+func (p *ProxyServices) GetService(name string, balancer *balancer, maxConnections int, dialer *websocket.Dialer) *ProxyService {
 	p.Lock()
 	defer p.Unlock()
 	pService := p.services[name]
@@ -85,8 +193,9 @@ func (p *ProxyServices) GetService(name string, backendURL string, maxConnection
 		pService = &ProxyService{
 			name:           name,
 			proxyclients:   make(map[string]*ProxyClient),
-			backendURL:     backendURL,
+			balancer:       balancer,
 			maxConnections: maxConnections,
+			dialer:         dialer,
 		}
 		p.services[name] = pService
 	}
@@ -98,40 +207,94 @@ func (p *ProxyServices) ReleaseService(name string) {
 	p.Lock()
 	defer p.Unlock()
 	if pService, ok := p.services[name]; ok {
-		if len(pService.proxyclients) <= 0 {
+		pService.RLock()
+		empty := len(pService.proxyclients) <= 0
+		pService.RUnlock()
+		if empty {
 			delete(p.services, name)
 		}
 	}
 }
 
-// start creates new ProxyClient instance and handles upstream & downstream flow
-func startProxyClient(wsp *WSProxy) error {
+// start creates new ProxyClient instance and handles upstream & downstream flow,
+// it returns the ended proxy client for its session stats
+func startProxyClient(wsp *WSProxy) (*ProxyClient, error) {
 	// get proxy service
-	pService := proxyServices.GetService(wsp.serviceName, wsp.backendURL, wsp.maxConnections)
+	pService := proxyServices.GetService(wsp.serviceName, wsp.balancer, wsp.maxConnections, wsp.dialer)
 	defer proxyServices.ReleaseService(wsp.serviceName)
 
 	// create proxy client
 	clientName := fmt.Sprintf("%s-%p-%s", wsp.serviceName, wsp.clientConn, wsp.clientConn.RemoteAddr())
 	pClient, err := pService.CreateProxyClient(clientName, wsp.clientConn)
 	if err != nil {
-		return fmt.Errorf("error while creating proxy - %s", err.Error())
+		return nil, fmt.Errorf("error while creating proxy - %s", err.Error())
 	}
 	defer pService.ReleaseProxyClient(pClient)
 	defer pClient.clientConn.Close()
+	pClient.upstream, pClient.downstream = wsp.upstream, wsp.downstream
+	pClient.keepalive, pClient.resume, pClient.logger = wsp.keepalive, wsp.resume, wsp.logger
+	pClient.dial = func() (*websocket.Conn, error) {
+		return pService.connectBackend(pClient, wsp)
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(pService.backendURL, nil)
+	if wsp.bridge != nil {
+		err = pService.selectHTTPBackend(pClient, wsp)
+	} else if wsp.tcp {
+		err = pService.connectTCP(pClient, wsp)
+	} else {
+		_, err = pClient.dial()
+	}
 	if err != nil {
-		m := fmt.Sprintf("failed to connect backend url[%s]", pService.backendURL)
-		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, m)
-		pClient.clientConn.WriteMessage(websocket.CloseMessage, closeMessage)
-		return fmt.Errorf("connection error: %s", err)
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "failed to connect backend")
+		pClient.writeClient(websocket.CloseMessage, closeMessage)
+		pClient.ended(ClosedByProxy, &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "failed to connect backend"})
+		return pClient, fmt.Errorf("connection error: %s", err)
+	}
+	// the backend connection may have been replaced by a reconnect
+	defer func() {
+		if conn := pClient.backendConn(); conn != nil {
+			conn.Close()
+		}
+		if pClient.tcpConn != nil {
+			pClient.tcpConn.Close()
+		}
+	}()
+	pClient.done = make(chan struct{})
+	defer close(pClient.done)
+	if wsp.bridge != nil {
+		var cancel context.CancelFunc
+		pClient.ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		pClient.bridge, pClient.header, pClient.balancer = wsp.bridge, wsp.header, wsp.balancer
+		pClient.slots = make(chan struct{}, wsp.bridge.concurrency)
+	}
+	if wsp.shadow != nil && wsp.shadow.sampled() {
+		target, err := backendURL(wsp.shadow.uri, wsp.pathParams, wsp.queryParams, wsp.forwardQuery)
+		if err != nil {
+			wsp.logger.Warnf("session [%s] isn't mirrored - %s", pClient.name, err)
+		} else {
+			pClient.mirror = newMirror(pClient.name, wsp.shadow, wsp.logger)
+			go pClient.mirror.run(wsp.dialer, target, wsp.header, pClient.done)
+		}
+	}
+	if wsp.tcp {
+		// the close of the client is answered once the backend ended its stream
+		pClient.tcpDone = make(chan struct{})
+		pClient.clientConn.SetCloseHandler(func(code int, text string) error { return nil })
+	}
+	pClient.handleControl(wsp.keepalive)
+	if wsp.keepalive.enabled() {
+		go pClient.watch(wsp.keepalive, pClient.done)
 	}
-	pClient.serverConn = conn
-	defer pClient.serverConn.Close()
 
 	// handle upstream & downstream on saparate goroutines
 	go pClient.upstreamPump()
-	go pClient.downstreamPump()
+	switch {
+	case wsp.tcp:
+		go pClient.tcpPump()
+	case wsp.bridge == nil:
+		go pClient.downstreamPump()
+	}
 
 	// wait until end of the streams
 	var errMessageTemplate string
@@ -140,24 +303,55 @@ func startProxyClient(wsp *WSProxy) error {
 	case err = <-pClient.upstreamErr:
 		errMessageTemplate = "error while copying from client to server: [%d] %v"
 		infoMessageTemplate = "close initiated from client: [%d] %v"
+		pClient.ended(ClosedByClient, err)
 	case err = <-pClient.downstreamErr:
 		errMessageTemplate = "error while copying from server to client: [%d] %v"
 		infoMessageTemplate = "close initiated from backend: [%d] %v"
+		pClient.ended(ClosedByBackend, err)
+	}
+	pClient.mu.Lock()
+	terminated, code, reason := pClient.terminated, pClient.closeCode, pClient.closeReason
+	pClient.mu.Unlock()
+	if terminated {
+		wsp.logger.Debugf("session terminated: [%d] %s", code, reason)
+		return pClient, nil
 	}
 	if e, ok := err.(*websocket.CloseError); ok {
 		if websocket.IsUnexpectedCloseError(e, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
-			return fmt.Errorf(errMessageTemplate, e.Code, e.Text)
+			return pClient, fmt.Errorf(errMessageTemplate, e.Code, e.Text)
 		}
-		return fmt.Errorf(infoMessageTemplate, e.Code, e.Text)
+		wsp.logger.Debugf(infoMessageTemplate, e.Code, e.Text)
+		return pClient, nil
 	}
 
-	return nil
+	return pClient, err
+}
+
+// ended records how the session ended, sessions closed by the proxy itself
+// keep the close code and reason sent by the proxy
+func (pc *ProxyClient) ended(closedBy string, err error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.endTime = time.Now()
+	if pc.closedBy != "" {
+		return
+	}
+	pc.closedBy = closedBy
+	if e, ok := err.(*websocket.CloseError); ok {
+		pc.closeCode, pc.closeReason = e.Code, e.Text
+	} else if err != nil {
+		pc.closeCode, pc.closeReason = websocket.CloseAbnormalClosure, err.Error()
+	}
 }
 
 // upstreamPump pumps message from client connection to server connection
 func (pc *ProxyClient) upstreamPump() {
 	for {
 		mt, message, err := pc.clientConn.ReadMessage()
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			pc.closeSession(websocket.CloseGoingAway, "keepalive timeout")
+			err = fmt.Errorf("client didn't answer keepalive pings within %s", pc.keepalive.pongTimeout)
+		}
 		if err != nil {
 			errMessage := websocket.FormatCloseMessage(websocket.CloseMessage, fmt.Sprintf("%v", err))
 			if e, ok := err.(*websocket.CloseError); ok {
@@ -165,24 +359,67 @@ func (pc *ProxyClient) upstreamPump() {
 					errMessage = websocket.FormatCloseMessage(e.Code, e.Text)
 				}
 			}
+			// no reconnect once the client is gone
+			pc.ended(ClosedByClient, err)
+			if e, ok := err.(*websocket.CloseError); ok && pc.tcpConn != nil {
+				pc.halfClose(e)
+			}
+			pc.upstreamErr <- err
+			pc.backendMu.Lock()
+			if conn := pc.backendConn(); conn != nil {
+				conn.WriteMessage(websocket.CloseMessage, errMessage)
+			}
+			pc.backendMu.Unlock()
+			break
+		}
+		pc.active()
+		pc.extend(pc.clientConn, pc.keepalive)
+		message, forward, err := pc.intercept(pc.upstream, DirectionUpstream, mt, message)
+		if err != nil {
 			pc.upstreamErr <- err
-			pc.serverConn.WriteMessage(websocket.CloseMessage, errMessage)
 			break
 		}
-		err = pc.serverConn.WriteMessage(mt, []byte(message))
+		if !forward {
+			continue
+		}
+		err = pc.send(mt, message)
+		if err == errBufferFull {
+			pc.closeSession(websocket.CloseTryAgainLater, err.Error())
+		}
 		if err != nil {
 			pc.upstreamErr <- err
 			break
 		}
+		if pc.mirror != nil {
+			pc.mirror.copy(mt, message)
+		}
 		copiedBytes := len(message)
-		pc.upstreamBytes += int64(copiedBytes)
+		atomic.AddInt64(&pc.upstreamBytes, int64(copiedBytes))
+		atomic.AddInt64(&pc.upstreamMessages, 1)
 	}
 }
 
 // downstreamPump pumps messages from server connection to client connection
 func (pc *ProxyClient) downstreamPump() {
 	for {
-		mt, message, err := pc.serverConn.ReadMessage()
+		conn := pc.backendConn()
+		mt, message, err := conn.ReadMessage()
+		if err != nil && pc.resume.retriable(err) && !pc.closing() {
+			pc.logger.Infof("backend of session [%s] dropped, reconnecting - %s", pc.name, err)
+			conn, err = pc.reconnect(err)
+			if err == nil {
+				pc.controlHandlers(conn, pc.client, pc.keepalive)
+				pc.logger.Infof("backend of session [%s] reconnected", pc.name)
+				continue
+			}
+			if !pc.closing() {
+				pc.closeSession(websocket.CloseTryAgainLater, "backend unavailable")
+			}
+		}
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			pc.closeSession(websocket.CloseGoingAway, "keepalive timeout")
+			err = fmt.Errorf("backend didn't answer keepalive pings within %s", pc.keepalive.pongTimeout)
+		}
 		if err != nil {
 			errMessage := websocket.FormatCloseMessage(websocket.CloseMessage, fmt.Sprintf("%v", err))
 			if e, ok := err.(*websocket.CloseError); ok {
@@ -191,17 +428,113 @@ func (pc *ProxyClient) downstreamPump() {
 				}
 			}
 			pc.downstreamErr <- err
-			pc.clientConn.WriteMessage(websocket.CloseMessage, errMessage)
+			pc.writeClient(websocket.CloseMessage, errMessage)
 			break
 		}
-		err = pc.clientConn.WriteMessage(mt, []byte(message))
+		pc.active()
+		pc.extend(conn, pc.keepalive)
+		if pc.mirror != nil {
+			pc.mirror.record(false, message)
+		}
+		message, forward, err := pc.intercept(pc.downstream, DirectionDownstream, mt, message)
+		if err != nil {
+			pc.downstreamErr <- err
+			break
+		}
+		if !forward {
+			continue
+		}
+		err = pc.writeClient(mt, []byte(message))
 		if err != nil {
 			pc.downstreamErr <- err
 			break
 		}
 		copiedBytes := len(message)
-		pc.downstreamBytes += int64(copiedBytes)
+		atomic.AddInt64(&pc.downstreamBytes, int64(copiedBytes))
+		atomic.AddInt64(&pc.downstreamMessages, 1)
+	}
+}
+
+// intercept applies the interceptor of a direction to a message, it returns
+// the message to forward, false when the message is dropped and an error when
+// the interceptor closed the session
+func (pc *ProxyClient) intercept(i *interceptor, direction string, mt int, message []byte) ([]byte, bool, error) {
+	if i == nil {
+		return message, true, nil
 	}
+	v, err := i.intercept(pc.name, direction, mt, message)
+	if err != nil {
+		// messages are never forwarded unchecked
+		pc.closeSession(websocket.CloseInternalServerErr, "message interceptor failed")
+		return nil, false, fmt.Errorf("closing session after %s message interceptor failure - %s", direction, err)
+	}
+	switch v.action {
+	case InterceptDrop:
+		return nil, false, nil
+	case InterceptClose:
+		pc.closeSession(websocket.ClosePolicyViolation, v.reason)
+		return nil, false, &websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: v.reason}
+	}
+	return v.message, true, nil
+}
+
+// closeSession sends a close message to the client and the backend, the
+// proxy is recorded as initiator
+func (pc *ProxyClient) closeSession(code int, reason string) {
+	pc.mu.Lock()
+	if pc.closedBy == "" {
+		pc.closedBy, pc.closeCode, pc.closeReason = ClosedByProxy, code, reason
+	}
+	serverConn := pc.serverConn
+	pc.mu.Unlock()
+	message := websocket.FormatCloseMessage(code, reason)
+	deadline := time.Now().Add(time.Second)
+	pc.clientConn.WriteControl(websocket.CloseMessage, message, deadline)
+	if serverConn != nil {
+		serverConn.WriteControl(websocket.CloseMessage, message, deadline)
+	}
+}
+
+// terminate closes the session with the supplied close code
+func (pc *ProxyClient) terminate(code int, reason string) {
+	pc.closeSession(code, reason)
+	pc.mu.Lock()
+	pc.terminated = true
+	serverConn, tcpConn := pc.serverConn, pc.tcpConn
+	pc.mu.Unlock()
+	// don't wait for the peers to complete the close handshake
+	pc.clientConn.Close()
+	if serverConn != nil {
+		serverConn.Close()
+	}
+	if tcpConn != nil {
+		tcpConn.Close()
+	}
+}
+
+// backendConn returns the current backend connection
+func (pc *ProxyClient) backendConn() *websocket.Conn {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.serverConn
+}
+
+// client returns the client connection
+func (pc *ProxyClient) client() *websocket.Conn {
+	return pc.clientConn
+}
+
+// writeClient writes to the client connection, the write lock is shared with
+// the trigger and the other flows writing to the connection
+func (pc *ProxyClient) writeClient(mt int, message []byte) error {
+	return wslock.WriteMessage(pc.clientConn, mt, message)
+}
+
+// closing reports whether the session is being closed
+func (pc *ProxyClient) closing() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.closedBy != ""
 }
 
 // status returns status of the proxy client
@@ -210,7 +543,37 @@ func (pc *ProxyClient) status() string {
 	name: %s
 	up time: %s
 	upstream bytes transferred: %d
-	downstream bytes transferred: %d`
-	status := fmt.Sprintf(statusTemplate, pc.name, time.Since(pc.startTime), pc.upstreamBytes, pc.downstreamBytes)
+	downstream bytes transferred: %d
+	upstream messages transferred: %d
+	downstream messages transferred: %d`
+	status := fmt.Sprintf(statusTemplate, pc.name, pc.upTime(), atomic.LoadInt64(&pc.upstreamBytes), atomic.LoadInt64(&pc.downstreamBytes),
+		atomic.LoadInt64(&pc.upstreamMessages), atomic.LoadInt64(&pc.downstreamMessages))
 	return status
 }
+
+// upTime returns the duration of the session so far or until it ended
+func (pc *ProxyClient) upTime() time.Duration {
+	if pc.endTime.IsZero() {
+		return time.Since(pc.startTime)
+	}
+	return pc.endTime.Sub(pc.startTime)
+}
+
+// output returns the session stats as activity output
+func (pc *ProxyClient) output() *Output {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return &Output{
+		SessionID:          pc.name,
+		Backend:            pc.target,
+		Duration:           int64(pc.upTime() / time.Millisecond),
+		UpstreamBytes:      atomic.LoadInt64(&pc.upstreamBytes),
+		DownstreamBytes:    atomic.LoadInt64(&pc.downstreamBytes),
+		UpstreamMessages:   atomic.LoadInt64(&pc.upstreamMessages),
+		DownstreamMessages: atomic.LoadInt64(&pc.downstreamMessages),
+		Reconnects:         atomic.LoadInt64(&pc.reconnects),
+		CloseCode:          pc.closeCode,
+		CloseReason:        pc.closeReason,
+		ClosedBy:           pc.closedBy,
+	}
+}
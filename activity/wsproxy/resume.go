@@ -0,0 +1,167 @@
+package wsproxy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errBufferFull is returned when the messages buffered during a backend
+// reconnect exceed the buffer size
+var errBufferFull = errors.New("backend reconnect buffer full")
+
+// resume holds the policy of transparent backend reconnects: the client
+// session is held open while the backend is redialed with exponential backoff
+// and full jitter, its messages are buffered and replayed after the resume
+// message once the backend is back
+type resume struct {
+	attempts     int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	timeout      time.Duration
+	bufferSize   int
+	message      string
+}
+
+// buffered is a client message waiting for the backend to reconnect
+type buffered struct {
+	mt      int
+	message []byte
+}
+
+// backoff returns a random delay between zero and the exponentially growing
+// ceiling for the attempt
+func (r *resume) backoff(attempt int) time.Duration {
+	ceiling := r.maxDelay
+	if attempt < 32 {
+		if d := r.initialDelay << uint(attempt); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retriable reports whether the backend connection is redialed after err,
+// a normal closure by the backend ends the session
+func (r *resume) retriable(err error) bool {
+	if r == nil || r.attempts == 0 {
+		return false
+	}
+	if e, ok := err.(*websocket.CloseError); ok {
+		return e.Code != websocket.CloseNormalClosure
+	}
+	return true
+}
+
+// send forwards a client message to the backend, it is buffered while the
+// backend reconnects. A failed write starts buffering as well when the
+// backend connection is redialed after errors
+func (pc *ProxyClient) send(mt int, message []byte) error {
+	if pc.bridge != nil {
+		return pc.request(mt, message)
+	}
+	if pc.tcpConn != nil {
+		_, err := pc.tcpConn.Write(message)
+		return err
+	}
+	pc.backendMu.Lock()
+	defer pc.backendMu.Unlock()
+	if !pc.reconnecting {
+		err := pc.backendConn().WriteMessage(mt, message)
+		if err == nil || !pc.resume.retriable(err) {
+			return err
+		}
+		// the read of the downstream pump fails as well and reconnects
+		pc.reconnecting = true
+		pc.backendConn().Close()
+	}
+	if pc.bufferedBytes+len(message) > pc.resume.bufferSize {
+		return errBufferFull
+	}
+	pc.buffer = append(pc.buffer, buffered{mt: mt, message: message})
+	pc.bufferedBytes += len(message)
+	return nil
+}
+
+// reconnect redials the backend after it dropped, the new connection gets
+// the resume message and the buffered client messages before any other
+// message. It gives up after the attempts or the timeout, or once the
+// session ended
+func (pc *ProxyClient) reconnect(cause error) (*websocket.Conn, error) {
+	r := pc.resume
+	pc.backendMu.Lock()
+	pc.reconnecting = true
+	pc.backendMu.Unlock()
+	pc.backendConn().Close()
+
+	deadline := time.Now().Add(r.timeout)
+	lastErr := cause
+	for attempt := 0; r.attempts < 0 || attempt < r.attempts; attempt++ {
+		delay := r.backoff(attempt)
+		if remaining := time.Until(deadline); delay > remaining {
+			delay = remaining
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-pc.done:
+			timer.Stop()
+			return nil, lastErr
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		conn, err := pc.dial()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		err = pc.replay(conn)
+		if err != nil {
+			conn.Close()
+			lastErr = err
+			continue
+		}
+		select {
+		case <-pc.done:
+			// the session ended while reconnecting
+			conn.Close()
+			return nil, lastErr
+		default:
+		}
+		atomic.AddInt64(&pc.reconnects, 1)
+		return conn, nil
+	}
+	return nil, fmt.Errorf("backend reconnect failed - %s", lastErr)
+}
+
+// replay sends the resume message and the buffered client messages to the
+// reconnected backend, client messages are forwarded to it afterwards
+func (pc *ProxyClient) replay(conn *websocket.Conn) error {
+	pc.backendMu.Lock()
+	defer pc.backendMu.Unlock()
+	if pc.resume.message != "" {
+		err := conn.WriteMessage(websocket.TextMessage, []byte(pc.resume.message))
+		if err != nil {
+			return err
+		}
+	}
+	// the buffer is kept until all of it is sent, the next connection gets
+	// all of it again
+	for _, b := range pc.buffer {
+		err := conn.WriteMessage(b.mt, b.message)
+		if err != nil {
+			return err
+		}
+	}
+	pc.buffer, pc.bufferedBytes = nil, 0
+	pc.reconnecting = false
+	return nil
+}
@@ -0,0 +1,42 @@
+package wsproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeBackoff(t *testing.T) {
+	r := &resume{initialDelay: time.Second, maxDelay: 5 * time.Second}
+	for attempt := 0; attempt < 40; attempt++ {
+		d := r.backoff(attempt)
+		assert.True(t, d >= 0 && d <= 5*time.Second, "delay %s of attempt %d", d, attempt)
+	}
+	assert.True(t, r.backoff(0) <= time.Second)
+	assert.Equal(t, time.Duration(0), (&resume{}).backoff(3))
+}
+
+func TestResumeRetriable(t *testing.T) {
+	var disabled *resume
+	assert.False(t, disabled.retriable(errors.New("EOF")))
+	r := &resume{attempts: 3}
+	assert.True(t, r.retriable(errors.New("EOF")))
+	assert.True(t, r.retriable(&websocket.CloseError{Code: websocket.CloseServiceRestart}))
+	assert.False(t, r.retriable(&websocket.CloseError{Code: websocket.CloseNormalClosure}), "a normal closure ends the session")
+}
+
+func TestResumeBuffer(t *testing.T) {
+	pc := &ProxyClient{resume: &resume{attempts: 1, bufferSize: 8, message: "resume"}, reconnecting: true}
+	assert.Nil(t, pc.send(websocket.TextMessage, []byte("one")))
+	assert.Nil(t, pc.send(websocket.TextMessage, []byte("two")))
+	assert.Equal(t, errBufferFull, pc.send(websocket.TextMessage, []byte("three")))
+	assert.Len(t, pc.buffer, 2)
+
+	assert.Nil(t, pc.replay(connPair(t)))
+	assert.False(t, pc.reconnecting)
+	assert.Empty(t, pc.buffer)
+	assert.Equal(t, 0, pc.bufferedBytes)
+}
@@ -0,0 +1,120 @@
+package wsproxy
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tcpBufferSize is the maximum size of the binary messages carrying the data
+// read from TCP backends
+const tcpBufferSize = 32 * 1024
+
+// tcpDrainTimeout bounds the wait for the end of the stream of a TCP backend
+// once the client closed the session
+const tcpDrainTimeout = 10 * time.Second
+
+// isTCP reports whether the backend uri selects a raw TCP backend
+func isTCP(uri string) bool {
+	return strings.HasPrefix(strings.ToLower(uri), "tcp://")
+}
+
+// connectTCP connects the TCP backend selected by the load balancer
+func (p *ProxyService) connectTCP(pc *ProxyClient, wsp *WSProxy) error {
+	return p.connect(pc, wsp, func(target string) error {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialTimeout("tcp", u.Host, p.dialer.HandshakeTimeout)
+		if err != nil {
+			return err
+		}
+		pc.mu.Lock()
+		pc.tcpConn = conn
+		pc.mu.Unlock()
+		return nil
+	})
+}
+
+// tcpPump pumps the stream of the TCP backend to the client, every read is
+// sent as binary message. The end of the stream closes the session normally
+// unless the client closed it first, halfClose answers that close
+func (pc *ProxyClient) tcpPump() {
+	defer close(pc.tcpDone)
+	buf := make([]byte, tcpBufferSize)
+	for {
+		n, err := pc.tcpConn.Read(buf)
+		if n > 0 {
+			pc.active()
+			message := append([]byte(nil), buf[:n]...)
+			if pc.mirror != nil {
+				pc.mirror.record(false, message)
+			}
+			message, forward, ierr := pc.intercept(pc.downstream, DirectionDownstream, websocket.BinaryMessage, message)
+			if ierr != nil {
+				pc.downstreamErr <- ierr
+				return
+			}
+			if forward {
+				werr := pc.writeClient(websocket.BinaryMessage, message)
+				if werr != nil {
+					pc.downstreamErr <- werr
+					return
+				}
+				atomic.AddInt64(&pc.downstreamBytes, int64(len(message)))
+				atomic.AddInt64(&pc.downstreamMessages, 1)
+			}
+		}
+		if err != nil {
+			pc.mu.Lock()
+			byClient := pc.closedBy == ClosedByClient
+			pc.mu.Unlock()
+			if byClient {
+				return
+			}
+			closeErr := &websocket.CloseError{Code: websocket.CloseGoingAway, Text: "backend connection lost"}
+			if err == io.EOF {
+				closeErr = &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "backend closed the connection"}
+				err = closeErr
+			}
+			pc.downstreamErr <- err
+			writeControl(pc.clientConn, websocket.CloseMessage, string(websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)))
+			return
+		}
+	}
+}
+
+// halfClose closes the sending side of the TCP backend connection once the
+// client closed the session, the remaining output of the backend is sent to
+// the client until the end of the stream before the close is answered
+func (pc *ProxyClient) halfClose(e *websocket.CloseError) {
+	if c, ok := pc.tcpConn.(*net.TCPConn); ok && c.CloseWrite() == nil {
+		timer := time.NewTimer(tcpDrainTimeout)
+		select {
+		case <-pc.tcpDone:
+		case <-timer.C:
+			pc.logger.Debugf("backend of session [%s] didn't end its stream within %s", pc.name, tcpDrainTimeout)
+		}
+		timer.Stop()
+	}
+	writeControl(pc.clientConn, websocket.CloseMessage, string(websocket.FormatCloseMessage(e.Code, "")))
+}
+
+// probeTCP checks a TCP backend by connecting it
+func probeTCP(uri string, dialer *net.Dialer) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	conn, err := dialer.Dial("tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
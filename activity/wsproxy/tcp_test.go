@@ -0,0 +1,155 @@
+package wsproxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// tcpBackend returns the uri of a TCP backend handling every connection
+// with handle
+func tcpBackend(t *testing.T, handle func(conn net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+// readStream reads binary messages until n bytes were received
+func readStream(t *testing.T, c *websocket.Conn, n int) string {
+	var received []byte
+	for len(received) < n {
+		mt, message, err := c.ReadMessage()
+		if !assert.Nil(t, err) {
+			break
+		}
+		assert.Equal(t, websocket.BinaryMessage, mt)
+		received = append(received, message...)
+	}
+	return string(received)
+}
+
+func TestIsTCP(t *testing.T) {
+	assert.True(t, isTCP("tcp://localhost:5900"))
+	assert.True(t, isTCP("TCP://localhost:23"))
+	assert.False(t, isTCP("ws://localhost/ws"))
+	assert.False(t, isTCP("http://localhost/api"))
+}
+
+func TestProbeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	dialer := &net.Dialer{Timeout: time.Second}
+	assert.Nil(t, probeTCP("tcp://"+l.Addr().String(), dialer))
+	l.Close()
+	assert.NotNil(t, probeTCP("tcp://"+l.Addr().String(), dialer))
+}
+
+func TestTCPHalfClose(t *testing.T) {
+	received := make(chan string, 1)
+	backend := tcpBackend(t, func(conn net.Conn) {
+		// answers once the client is done sending
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+		conn.Write([]byte("bye"))
+		time.Sleep(20 * time.Millisecond)
+		conn.Write([]byte(" now"))
+	})
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "Sync"})
+	client, evaluated := evalSync(t, a)
+
+	assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte("data")))
+	assert.Nil(t, client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	assert.Equal(t, "data", <-received)
+	assert.Equal(t, "bye now", readStream(t, client, len("bye now")), "the rest of the stream is sent after the close of the client")
+	_, _, err := client.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "the close is answered at the end of the stream, got %v", err)
+
+	out := &Output{}
+	(<-evaluated).GetOutputObject(out)
+	assert.Equal(t, ClosedByClient, out.ClosedBy)
+	assert.Equal(t, websocket.CloseNormalClosure, out.CloseCode)
+	assert.Equal(t, int64(len("bye now")), out.DownstreamBytes)
+	assert.Equal(t, "", out.Error)
+}
+
+func TestTCPEcho(t *testing.T) {
+	backend := tcpBackend(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+	})
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "Sync"})
+	client, evaluated := evalSync(t, a)
+
+	assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte("hello")))
+	assert.Equal(t, "hello", readStream(t, client, len("hello")))
+	assert.Nil(t, client.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2}))
+	assert.Equal(t, string([]byte{0, 1, 2}), readStream(t, client, 3))
+	assert.Nil(t, client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done")))
+	_, _, err := client.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error %v", err)
+
+	out := &Output{}
+	(<-evaluated).GetOutputObject(out)
+	assert.Equal(t, backend, out.Backend)
+	assert.Equal(t, int64(8), out.UpstreamBytes)
+	assert.Equal(t, int64(2), out.UpstreamMessages)
+	assert.Equal(t, int64(8), out.DownstreamBytes)
+	assert.True(t, out.DownstreamMessages >= 2)
+	assert.Equal(t, ClosedByClient, out.ClosedBy)
+	assert.Equal(t, "done", out.CloseReason)
+	assert.Equal(t, "", out.Error)
+}
+
+func TestTCPBackendClose(t *testing.T) {
+	backend := tcpBackend(t, func(conn net.Conn) {
+		conn.Write([]byte("banner"))
+	})
+	a := newTestActivity(t, map[string]interface{}{"uri": backend, "mode": "Sync"})
+	client, evaluated := evalSync(t, a)
+
+	assert.Equal(t, "banner", readStream(t, client, len("banner")))
+	_, _, err := client.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if assert.True(t, ok, "unexpected error %v", err) {
+		assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+		assert.Equal(t, "backend closed the connection", closeErr.Text)
+	}
+
+	out := &Output{}
+	(<-evaluated).GetOutputObject(out)
+	assert.Equal(t, ClosedByBackend, out.ClosedBy)
+	assert.Equal(t, websocket.CloseNormalClosure, out.CloseCode)
+	assert.Equal(t, int64(len("banner")), out.DownstreamBytes)
+	assert.Equal(t, int64(1), out.DownstreamMessages)
+	assert.Equal(t, int64(0), out.UpstreamMessages)
+	assert.Equal(t, "", out.Error)
+}
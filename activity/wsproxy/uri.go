@@ -0,0 +1,42 @@
+package wsproxy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// backendURL fills the {param} placeholders of a backend uri with the path
+// params of the client request and then with its query params, the first value
+// of a repeating query param is used. Values are escaped so that they can't
+// change the backend path. With forwardQuery the query params of the client
+// request are added to the query of the backend uri
+func backendURL(uri string, pathParams map[string]string, queryParams map[string]interface{}, forwardQuery bool) (string, error) {
+	for name, value := range pathParams {
+		uri = strings.Replace(uri, "{"+name+"}", url.PathEscape(value), -1)
+	}
+	for name, value := range queryParams {
+		if values := headerValues(value); len(values) > 0 {
+			uri = strings.Replace(uri, "{"+name+"}", url.PathEscape(values[0]), -1)
+		}
+	}
+	if start := strings.Index(uri, "{"); start >= 0 && strings.Index(uri[start:], "}") > 0 {
+		return "", fmt.Errorf("param of placeholder %s not set for backend uri [%s]", uri[start:start+strings.Index(uri[start:], "}")+1], uri)
+	}
+	if !forwardQuery || len(queryParams) == 0 {
+		return uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid backend uri [%s] - %s", uri, err)
+	}
+	query := u.Query()
+	for name, value := range queryParams {
+		// repeating query params are arrays
+		for _, v := range headerValues(value) {
+			query.Add(name, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
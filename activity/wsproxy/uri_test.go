@@ -0,0 +1,24 @@
+package wsproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendURL(t *testing.T) {
+	u, err := backendURL("ws://backend/rooms/{room}", map[string]string{"room": "lobby"}, map[string]interface{}{"token": "x"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://backend/rooms/lobby", u)
+
+	u, err = backendURL("ws://backend/rooms/{room}?v=1", map[string]string{"room": "../admin"}, map[string]interface{}{"tag": []interface{}{"a", "b"}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://backend/rooms/..%2Fadmin?tag=a&tag=b&v=1", u)
+
+	u, err = backendURL("ws://backend/rooms/{room}/{user}", map[string]string{"room": "lobby"}, map[string]interface{}{"room": "other", "user": []interface{}{"a b", "c"}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://backend/rooms/lobby/a%20b", u, "query params fill the placeholders left by the path params")
+
+	_, err = backendURL("ws://backend/rooms/{room}", nil, nil, false)
+	assert.NotNil(t, err, "placeholders must be filled")
+}
@@ -3,9 +3,13 @@ module github.com/project-flogo/websocket
 require (
 	github.com/gorilla/websocket v1.4.0
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/pkg/errors v0.9.1
+	github.com/project-flogo/contrib/activity/rest v0.9.0-rc.1.0.20190509204259-4246269fb68e
+	github.com/project-flogo/contrib/trigger/rest v0.9.0-rc.1.0.20190509204259-4246269fb68e
 	github.com/project-flogo/core v1.3.0
 	github.com/project-flogo/microgateway v0.1.0
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20190510104115-cbcb75029529
 )
 
 go 1.13
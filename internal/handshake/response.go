@@ -0,0 +1,25 @@
+package handshake
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Response converts the response of a websocket handshake into an output
+// object with the status code, the response headers and the negotiated
+// extensions and subprotocol. Repeated headers are joined with a comma
+func Response(res *http.Response) map[string]interface{} {
+	if res == nil {
+		return nil
+	}
+	headers := make(map[string]interface{}, len(res.Header))
+	for key, values := range res.Header {
+		headers[key] = strings.Join(values, ",")
+	}
+	return map[string]interface{}{
+		"status":      res.StatusCode,
+		"headers":     headers,
+		"extensions":  strings.Join(res.Header["Sec-Websocket-Extensions"], ","),
+		"subprotocol": res.Header.Get("Sec-Websocket-Protocol"),
+	}
+}
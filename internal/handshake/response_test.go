@@ -0,0 +1,23 @@
+package handshake
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse(t *testing.T) {
+	assert.Nil(t, Response(nil))
+
+	res := &http.Response{StatusCode: http.StatusSwitchingProtocols, Header: http.Header{}}
+	res.Header.Add("Sec-WebSocket-Protocol", "graphql-ws")
+	res.Header.Add("Sec-WebSocket-Extensions", "permessage-deflate")
+	res.Header.Add("Set-Cookie", "session=1")
+	res.Header.Add("Set-Cookie", "region=eu")
+	out := Response(res)
+	assert.Equal(t, 101, out["status"])
+	assert.Equal(t, "graphql-ws", out["subprotocol"])
+	assert.Equal(t, "permessage-deflate", out["extensions"])
+	assert.Equal(t, "session=1,region=eu", out["headers"].(map[string]interface{})["Set-Cookie"])
+}
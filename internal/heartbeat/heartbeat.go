@@ -0,0 +1,121 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Heartbeat is an application level heartbeat: a message sent at a fixed
+// interval which the peer answers with a response matching the configured one
+type Heartbeat struct {
+	message  []byte
+	response string
+	fields   map[string]interface{}
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// New returns nil when no heartbeat message is configured. When response is a
+// JSON object, a received JSON object matches if it contains all its fields,
+// otherwise a received message matches if it contains the response text
+func New(message, response string, interval, timeout time.Duration) (*Heartbeat, error) {
+	if message == "" {
+		return nil, nil
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("heartbeat interval must be greater than 0")
+	}
+	h := &Heartbeat{message: []byte(message), response: response, interval: interval, timeout: timeout}
+	if response != "" {
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(response), &fields) == nil {
+			h.fields = fields
+		}
+	}
+	return h, nil
+}
+
+// Matches reports whether a received message is the heartbeat response
+func (h *Heartbeat) Matches(message []byte) bool {
+	if h.response == "" {
+		return false
+	}
+	if h.fields == nil {
+		return strings.Contains(string(message), h.response)
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(message, &fields) != nil {
+		return false
+	}
+	for key, value := range h.fields {
+		if !reflect.DeepEqual(fields[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Monitor tracks the heartbeat of a single connection
+type Monitor struct {
+	heartbeat *Heartbeat
+	received  chan struct{}
+}
+
+// Monitor creates the monitor for a new connection
+func (h *Heartbeat) Monitor() *Monitor {
+	return &Monitor{heartbeat: h, received: make(chan struct{}, 1)}
+}
+
+// Received records a received message, it reports whether the message is the
+// heartbeat response which must not be dispatched. Without a configured
+// response any message proves the connection is alive
+func (m *Monitor) Received(message []byte) bool {
+	matches := m.heartbeat.Matches(message)
+	if matches || m.heartbeat.response == "" {
+		select {
+		case m.received <- struct{}{}:
+		default:
+		}
+	}
+	return matches
+}
+
+// Run sends the heartbeat message at every interval until done is closed. It
+// returns an error when sending fails or the response doesn't arrive within
+// the timeout after a heartbeat was sent
+func (m *Monitor) Run(send func(message []byte) error, done <-chan struct{}) error {
+	ticker := time.NewTicker(m.heartbeat.interval)
+	defer ticker.Stop()
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			err := send(m.heartbeat.message)
+			if err != nil {
+				return fmt.Errorf("error while sending heartbeat - %s", err)
+			}
+			if timeout == nil && m.heartbeat.timeout > 0 {
+				timer = time.NewTimer(m.heartbeat.timeout)
+				timeout = timer.C
+			}
+		case <-m.received:
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+		case <-timeout:
+			return fmt.Errorf("heartbeat response not received within %s", m.heartbeat.timeout)
+		}
+	}
+}
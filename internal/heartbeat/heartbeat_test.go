@@ -0,0 +1,51 @@
+package heartbeat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatches(t *testing.T) {
+	h, err := New(`{"op":"ping"}`, `{"op":"pong"}`, time.Second, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, h.Matches([]byte(`{"op": "pong", "ts": 1}`)))
+	assert.False(t, h.Matches([]byte(`{"op":"trade"}`)))
+	assert.False(t, h.Matches([]byte(`pong`)))
+
+	h, err = New("ping", "pong", time.Second, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, h.Matches([]byte("pong 123")))
+	assert.False(t, h.Matches([]byte("trade")))
+
+	h, err = New("", "pong", time.Second, time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+
+	_, err = New("ping", "pong", 0, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestMonitor(t *testing.T) {
+	h, _ := New("ping", "pong", 10*time.Millisecond, 50*time.Millisecond)
+
+	m := h.Monitor()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(10 * time.Millisecond)
+			assert.True(t, m.Received([]byte("pong")))
+		}
+		close(done)
+	}()
+	assert.Nil(t, m.Run(func([]byte) error { return nil }, done), "answered heartbeats keep running")
+
+	m = h.Monitor()
+	assert.False(t, m.Received([]byte("trade")))
+	assert.NotNil(t, m.Run(func([]byte) error { return nil }, make(chan struct{})), "unanswered heartbeat times out")
+
+	m = h.Monitor()
+	assert.NotNil(t, m.Run(func([]byte) error { return errors.New("closed") }, make(chan struct{})))
+}
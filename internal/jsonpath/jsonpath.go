@@ -0,0 +1,71 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled simple JSON path such as $.data.items[0].symbol
+type Path []interface{}
+
+// Compile parses a dot notation path. The leading "$" is optional and array
+// elements are addressed with [index]
+func Compile(path string) (Path, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, fmt.Errorf("JSON path is empty")
+	}
+	var p Path
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		var indexes []int
+		if i := strings.Index(part, "["); i > -1 {
+			name = part[:i]
+			for _, idx := range strings.Split(part[i:], "[")[1:] {
+				if !strings.HasSuffix(idx, "]") {
+					return nil, fmt.Errorf("invalid JSON path [%s]", path)
+				}
+				n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in JSON path [%s]", path)
+				}
+				indexes = append(indexes, n)
+			}
+		}
+		if name != "" {
+			p = append(p, name)
+		}
+		for _, n := range indexes {
+			p = append(p, n)
+		}
+	}
+	return p, nil
+}
+
+// Get returns the value the path points to in decoded JSON content
+func (p Path) Get(content interface{}) (interface{}, bool) {
+	current := content
+	for _, step := range p {
+		switch s := step.(type) {
+		case string:
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			current, ok = obj[s]
+			if !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := current.([]interface{})
+			if !ok || s < 0 || s >= len(arr) {
+				return nil, false
+			}
+			current = arr[s]
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,84 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Path
+		invalid  bool
+	}{
+		{path: "$.symbol", expected: Path{"symbol"}},
+		{path: "symbol", expected: Path{"symbol"}},
+		{path: " $.data.items.symbol ", expected: Path{"data", "items", "symbol"}},
+		{path: "$.items[0]", expected: Path{"items", 0}},
+		{path: "$.items[1][2].price", expected: Path{"items", 1, 2, "price"}},
+		{path: "$[3].id", expected: Path{3, "id"}},
+		{path: "$", invalid: true},
+		{path: "", invalid: true},
+		{path: "$.items[0", invalid: true},
+		{path: "$.items[a]", invalid: true},
+		{path: "$.items[0]x", invalid: true},
+	}
+	for _, test := range tests {
+		p, err := Compile(test.path)
+		if test.invalid {
+			assert.NotNil(t, err, test.path)
+			continue
+		}
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.expected, p, test.path)
+	}
+}
+
+func TestGet(t *testing.T) {
+	var content interface{}
+	err := json.Unmarshal([]byte(`{
+		"symbol": "ABC",
+		"data": {"price": 1.5, "tags": ["a", "b"], "nested": {"id": 7}},
+		"items": [{"id": 1}, {"id": 2}],
+		"empty": null
+	}`), &content)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		path     string
+		expected interface{}
+		missing  bool
+	}{
+		{path: "$.symbol", expected: "ABC"},
+		{path: "$.data.price", expected: 1.5},
+		{path: "$.data.nested.id", expected: float64(7)},
+		{path: "$.data.tags[1]", expected: "b"},
+		{path: "$.items[0].id", expected: float64(1)},
+		{path: "$.empty", expected: nil},
+		{path: "$.unknown", missing: true},
+		{path: "$.data.unknown.id", missing: true},
+		{path: "$.items[2].id", missing: true},
+		{path: "$.items[-1]", missing: true},
+		{path: "$.symbol.length", missing: true},
+		{path: "$.data[0]", missing: true},
+		{path: "$.items.id", missing: true},
+		{path: "$.empty.id", missing: true},
+	}
+	for _, test := range tests {
+		p, err := Compile(test.path)
+		assert.Nil(t, err, test.path)
+		value, ok := p.Get(content)
+		if test.missing {
+			assert.False(t, ok, test.path)
+			continue
+		}
+		assert.True(t, ok, test.path)
+		assert.Equal(t, test.expected, value, test.path)
+	}
+
+	p, _ := Compile("$.symbol")
+	_, ok := p.Get("not an object")
+	assert.False(t, ok, "content isn't an object")
+}
@@ -0,0 +1,210 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+)
+
+const (
+	// AuthStyleHeader sends the client credentials as HTTP basic authentication
+	AuthStyleHeader = "Header"
+	// AuthStyleBody sends the client credentials as form parameters
+	AuthStyleBody = "Body"
+)
+
+const (
+	// TokenInHeader sends the token as a request header
+	TokenInHeader = "Header"
+	// TokenInQuery sends the token as a query param
+	TokenInQuery = "Query"
+)
+
+// defaultRenewBefore is subtracted from the token lifetime so that a token is
+// never used right before it expires
+const defaultRenewBefore = 10 * time.Second
+
+// Config is the OAuth2 client credentials grant configuration
+type Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       string
+	AuthStyle    string
+	// TokenIn and TokenName select where the token is sent, by default as
+	// "Authorization: Bearer <token>" header or as access_token query param
+	TokenIn   string
+	TokenName string
+	// RenewBefore is how long before its expiry a cached token is renewed
+	RenewBefore time.Duration
+}
+
+// Token is an access token along with its expiry, a zero expiry never expires
+type Token struct {
+	AccessToken string
+	TokenType   string
+	Expiry      time.Time
+}
+
+// Source fetches access tokens from the token endpoint and caches them until
+// they expire
+type Source struct {
+	config *Config
+	client *http.Client
+	token  *Token
+	mu     sync.Mutex
+}
+
+// NewSource returns nil when no token url is configured
+func NewSource(c *Config, client *http.Client) (*Source, error) {
+	if c.TokenURL == "" {
+		return nil, nil
+	}
+	if c.ClientID == "" {
+		return nil, fmt.Errorf("client id is required to fetch OAuth2 tokens")
+	}
+	switch {
+	case c.AuthStyle == "" || strings.EqualFold(c.AuthStyle, AuthStyleHeader):
+		c.AuthStyle = AuthStyleHeader
+	case strings.EqualFold(c.AuthStyle, AuthStyleBody):
+		c.AuthStyle = AuthStyleBody
+	default:
+		return nil, fmt.Errorf("unsupported OAuth2 auth style [%s]", c.AuthStyle)
+	}
+	switch {
+	case c.TokenIn == "" || strings.EqualFold(c.TokenIn, TokenInHeader):
+		c.TokenIn = TokenInHeader
+		if c.TokenName == "" {
+			c.TokenName = "Authorization"
+		}
+	case strings.EqualFold(c.TokenIn, TokenInQuery):
+		c.TokenIn = TokenInQuery
+		if c.TokenName == "" {
+			c.TokenName = "access_token"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported OAuth2 token location [%s]", c.TokenIn)
+	}
+	if c.RenewBefore <= 0 {
+		c.RenewBefore = defaultRenewBefore
+	}
+	return &Source{config: c, client: client}, nil
+}
+
+// Token returns the cached token or fetches a new one when it expired
+func (s *Source) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && (s.token.Expiry.IsZero() || time.Now().Add(s.config.RenewBefore).Before(s.token.Expiry)) {
+		return s.token, nil
+	}
+	token, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// Apply adds the current token to the url or a copy of the headers of a
+// handshake request, it returns the token to schedule its renewal
+func (s *Source) Apply(rawurl string, header http.Header) (string, http.Header, *Token, error) {
+	token, err := s.Token()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if s.config.TokenIn == TokenInQuery {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		query := u.Query()
+		query.Set(s.config.TokenName, token.AccessToken)
+		u.RawQuery = query.Encode()
+		return u.String(), header, token, nil
+	}
+	withToken := make(http.Header, len(header)+1)
+	for key, values := range header {
+		withToken[key] = values
+	}
+	value := token.AccessToken
+	if strings.EqualFold(s.config.TokenName, "Authorization") {
+		value = token.TokenType + " " + value
+	}
+	withToken.Set(s.config.TokenName, value)
+	return rawurl, withToken, token, nil
+}
+
+// Invalidate drops the cached token, e.g. when the server rejected it
+func (s *Source) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+}
+
+func (s *Source) fetch() (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if scopes := strings.Fields(strings.Replace(s.config.Scopes, ",", " ", -1)); len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	if s.config.AuthStyle == AuthStyleBody {
+		form.Set("client_id", s.config.ClientID)
+		form.Set("client_secret", s.config.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.config.AuthStyle == AuthStyleHeader {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+	issued := time.Now()
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching OAuth2 token - %s", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading OAuth2 token response - %s", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OAuth2 token endpoint responded with status [%d], payload is: %s", res.StatusCode, body)
+	}
+	var content struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   interface{} `json:"expires_in"`
+	}
+	err = json.Unmarshal(body, &content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OAuth2 token response - %s", err)
+	}
+	if content.AccessToken == "" {
+		return nil, fmt.Errorf("OAuth2 token response doesn't contain an access token")
+	}
+	token := &Token{AccessToken: content.AccessToken, TokenType: content.TokenType}
+	if token.TokenType == "" || strings.EqualFold(token.TokenType, "bearer") {
+		token.TokenType = "Bearer"
+	}
+	if content.ExpiresIn != nil {
+		// some servers send the lifetime as a string
+		expiresIn, err := coerce.ToInt64(content.ExpiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OAuth2 token expires_in [%v] - %s", content.ExpiresIn, err)
+		}
+		if expiresIn > 0 {
+			token.Expiry = issued.Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	return token, nil
+}
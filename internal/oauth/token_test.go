@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	var fetched int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		user, password, _ := r.BasicAuth()
+		r.ParseForm()
+		assert.Equal(t, "client", user)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "read write", r.Form.Get("scope"))
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":"3600"}`, fetched)
+	}))
+	defer server.Close()
+
+	s, err := NewSource(&Config{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret", Scopes: "read,write"}, server.Client())
+	assert.Nil(t, err)
+	u, header, token, err := s.Apply("ws://feed/ws?a=1", http.Header{"X-Custom": {"1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://feed/ws?a=1", u)
+	assert.Equal(t, "Bearer token-1", header.Get("Authorization"))
+	assert.Equal(t, "1", header.Get("X-Custom"))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+
+	token, _ = s.Token()
+	assert.Equal(t, "token-1", token.AccessToken, "token is cached until it expires")
+	s.token.Expiry = time.Now().Add(time.Second)
+	token, _ = s.Token()
+	assert.Equal(t, "token-2", token.AccessToken)
+
+	s, err = NewSource(&Config{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret", Scopes: "read write", TokenIn: "query"}, server.Client())
+	assert.Nil(t, err)
+	u, _, _, err = s.Apply("ws://feed/ws?a=1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://feed/ws?a=1&access_token=token-3", u)
+}
+
+func TestSourceConfig(t *testing.T) {
+	s, err := NewSource(&Config{}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+	_, err = NewSource(&Config{TokenURL: "http://idp/token"}, nil)
+	assert.NotNil(t, err)
+	_, err = NewSource(&Config{TokenURL: "http://idp/token", ClientID: "client", TokenIn: "Cookie"}, nil)
+	assert.NotNil(t, err)
+}
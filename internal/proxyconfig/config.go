@@ -0,0 +1,142 @@
+package proxyconfig
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Config is the HTTP CONNECT forward proxy used for outbound websocket
+// connections. Empty values default to the HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY environment variables
+type Config struct {
+	URL      string
+	User     string
+	Password string
+	NoProxy  string
+}
+
+// ProxyFunc returns the function selecting the proxy of a websocket handshake
+// request, as used by websocket.Dialer.Proxy
+func (c *Config) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	var proxyURL *url.URL
+	if c.URL != "" {
+		u, err := parse(c.URL)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL = u
+	}
+	noProxy := c.NoProxy
+	if noProxy == "" {
+		noProxy = getenv("NO_PROXY")
+	}
+	bypass := parseNoProxy(noProxy)
+	return func(req *http.Request) (*url.URL, error) {
+		if bypass(req.URL.Host) {
+			return nil, nil
+		}
+		u := proxyURL
+		if u == nil {
+			env := getenv("HTTP_PROXY")
+			if req.URL.Scheme == "https" {
+				if e := getenv("HTTPS_PROXY"); e != "" {
+					env = e
+				}
+			}
+			if env == "" {
+				return nil, nil
+			}
+			var err error
+			u, err = parse(env)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if c.User != "" {
+			// don't modify the shared url
+			withUser := *u
+			withUser.User = url.UserPassword(c.User, c.Password)
+			u = &withUser
+		}
+		return u, nil
+	}, nil
+}
+
+func getenv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+func parse(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url [%s] - %s", proxy, err)
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported proxy url [%s], only http proxies are supported", proxy)
+	}
+	return u, nil
+}
+
+// parseNoProxy returns the function reporting whether a host:port bypasses the
+// proxy. Entries are host names matching the host and its subdomains, domains
+// with a leading dot matching subdomains only, IP addresses, CIDR ranges,
+// optionally with a port, or "*" matching all hosts
+func parseNoProxy(noProxy string) func(hostport string) bool {
+	var hosts, domains []string
+	var nets []*net.IPNet
+	var all bool
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			all = true
+		case strings.Contains(entry, "/"):
+			if _, n, err := net.ParseCIDR(entry); err == nil {
+				nets = append(nets, n)
+			}
+		case strings.HasPrefix(entry, "."):
+			domains = append(domains, entry)
+		default:
+			hosts = append(hosts, entry)
+		}
+	}
+	return func(hostport string) bool {
+		if all {
+			return true
+		}
+		hostport = strings.ToLower(hostport)
+		host, _, err := net.SplitHostPort(hostport)
+		if err != nil {
+			host = hostport
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+		for _, h := range hosts {
+			if h == hostport || h == host || strings.HasSuffix(host, "."+h) {
+				return true
+			}
+		}
+		for _, d := range domains {
+			if strings.HasSuffix(host, d) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,240 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/log"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	pemBegin = "-----BEGIN "
+	pemEnd   = "-----END "
+)
+
+// LoadBytes resolves a certificate setting into raw bytes. The value can be
+// a file or directory path, a file selector JSON object, a "base64,<data>"
+// string, plain base64 or inline PEM content
+func LoadBytes(certVal string, logger log.Logger) ([]byte, error) {
+	certVal = strings.TrimSpace(certVal)
+	if certVal == "" {
+		return nil, fmt.Errorf("Certificate is Empty")
+	}
+
+	//if certificate comes from fileselctor it will be base64 encoded
+	if strings.HasPrefix(certVal, "{") {
+		logger.Debug("Certificate received from FileSelector")
+		certObj, err := coerce.ToObject(certVal)
+		if err != nil {
+			return nil, err
+		}
+		certRealValue, ok := certObj["content"].(string)
+		if !ok || certRealValue == "" {
+			return nil, fmt.Errorf("Did not found the certificate content")
+		}
+		if index := strings.IndexAny(certRealValue, ","); index > -1 {
+			certRealValue = certRealValue[index+1:]
+		}
+		return base64.StdEncoding.DecodeString(certRealValue)
+	}
+
+	if strings.Contains(certVal, pemBegin) {
+		logger.Debug("Certificate received as PEM content")
+		return repairPEM(certVal), nil
+	}
+
+	if fileInfo, err := os.Stat(certVal); err == nil {
+		if fileInfo.IsDir() {
+			logger.Debugf("Certificate received as directory [%s]", certVal)
+			return readDir(certVal)
+		}
+		logger.Debugf("Certificate received as file [%s]", certVal)
+		return ioutil.ReadFile(certVal)
+	}
+
+	//if the certificate comes from application properties need to check whether that it contains , ans encoding
+	if index := strings.IndexAny(certVal, ","); index > -1 {
+		encoding := certVal[:index]
+		if !strings.EqualFold(encoding, "base64") {
+			return nil, fmt.Errorf("Error in parsing the certificates Or we may be not be supporting the given encoding")
+		}
+		certVal = certVal[index+1:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(certVal)
+	if err != nil {
+		return nil, fmt.Errorf("Certificate is neither an existing file, PEM content nor base64 encoded - %v", err)
+	}
+	return decoded, nil
+}
+
+// readDir concatenates every regular file of the directory, which is how
+// trust store directories are consumed
+func readDir(dir string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("Failed to read certificates from [%s]  Must be a directory containing certificates in PEM format", dir)
+	}
+	var buf bytes.Buffer
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		buf.Write(content)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// repairPEM restores line breaks of PEM content whose new lines were
+// replaced by spaces, e.g. when pasted into an application property
+func repairPEM(certVal string) []byte {
+	if strings.Contains(certVal, "\n") {
+		return []byte(certVal)
+	}
+	var buf bytes.Buffer
+	rest := certVal
+	for {
+		start := strings.Index(rest, pemBegin)
+		if start < 0 {
+			break
+		}
+		headerEnd := strings.Index(rest[start+len(pemBegin):], "-----")
+		if headerEnd < 0 {
+			break
+		}
+		headerEnd += start + len(pemBegin) + len("-----")
+		footer := strings.Index(rest[headerEnd:], pemEnd)
+		if footer < 0 {
+			break
+		}
+		footer += headerEnd
+		footerEnd := strings.Index(rest[footer+len(pemEnd):], "-----")
+		if footerEnd < 0 {
+			break
+		}
+		footerEnd += footer + len(pemEnd) + len("-----")
+
+		buf.WriteString(rest[start:headerEnd])
+		buf.WriteByte('\n')
+		for _, line := range strings.Fields(rest[headerEnd:footer]) {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(rest[footer:footerEnd])
+		buf.WriteByte('\n')
+		rest = rest[footerEnd:]
+	}
+	if buf.Len() == 0 {
+		return []byte(certVal)
+	}
+	return buf.Bytes()
+}
+
+// toPEMBlocks converts PEM, PKCS#12 or DER encoded data into PEM blocks
+func toPEMBlocks(data []byte, password string) ([]*pem.Block, error) {
+	if bytes.Contains(data, []byte(pemBegin)) {
+		var blocks []*pem.Block
+		rest := data
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("Unsupported certificate found. It must be a valid PEM certificate.")
+		}
+		return blocks, nil
+	}
+	if blocks, err := pkcs12.ToPEM(data, password); err == nil {
+		return blocks, nil
+	}
+	certs, err := x509.ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported certificate found. It must be PEM, PKCS#12 or DER encoded")
+	}
+	var blocks []*pem.Block
+	for _, cert := range certs {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return blocks, nil
+}
+
+// LoadCertPool builds a certificate pool out of a trust store setting
+func LoadCertPool(trustStore string, password string, logger log.Logger) (*x509.CertPool, error) {
+	data, err := LoadBytes(trustStore, logger)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := toPEMBlocks(data, password)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	for _, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			logger.Warnf("Skipping invalid trusted certificate - %v", err)
+			continue
+		}
+		certPool.AddCert(cert)
+	}
+	if len(certPool.Subjects()) < 1 {
+		return nil, fmt.Errorf("Failed to read trusted certificates, no valid trusted certs were found")
+	}
+	return certPool, nil
+}
+
+// LoadKeyPair builds a certificate out of a certificate and key setting. The
+// key may be empty when the certificate is a PEM bundle or a PKCS#12 archive
+// holding both
+func LoadKeyPair(certVal string, keyVal string, password string, logger log.Logger) (tls.Certificate, error) {
+	certData, err := LoadBytes(certVal, logger)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	blocks, err := toPEMBlocks(certData, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyVal != "" {
+		keyData, err := LoadBytes(keyVal, logger)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		keyBlocks, err := toPEMBlocks(keyData, password)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		blocks = append(blocks, keyBlocks...)
+	}
+
+	var certPEM, keyPEM []byte
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})...)
+		} else if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
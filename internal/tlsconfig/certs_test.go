@@ -0,0 +1,132 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateCert(t *testing.T, cn string) (certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM
+}
+
+func TestLoadCertPool(t *testing.T) {
+	logger := log.RootLogger()
+	certPEM, _ := generateCert(t, "ca")
+
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(file, certPEM, 0600))
+
+	fileSelector := `{"filename":"ca.pem","content":"data:application/x-x509-ca-cert;base64,` + base64.StdEncoding.EncodeToString(certPEM) + `"}`
+	flattened := strings.Replace(strings.TrimSpace(string(certPEM)), "\n", " ", -1)
+
+	for _, value := range []string{dir, file, fileSelector, "base64," + base64.StdEncoding.EncodeToString(certPEM),
+		base64.StdEncoding.EncodeToString(certPEM), string(certPEM), flattened} {
+		pool, err := LoadCertPool(value, "", logger)
+		assert.Nil(t, err)
+		if assert.NotNil(t, pool) {
+			assert.Len(t, pool.Subjects(), 1)
+		}
+	}
+
+	_, err = LoadCertPool("not a certificate", "", logger)
+	assert.NotNil(t, err)
+}
+
+func TestLoadKeyPairBundle(t *testing.T) {
+	certPEM, keyPEM := generateCert(t, "server")
+	bundle := string(certPEM) + string(keyPEM)
+
+	cert, err := LoadKeyPair(bundle, "", "", log.RootLogger())
+	assert.Nil(t, err)
+	assert.Len(t, cert.Certificate, 1)
+
+	cert, err = LoadKeyPair(string(certPEM), string(keyPEM), "", log.RootLogger())
+	assert.Nil(t, err)
+	assert.Len(t, cert.Certificate, 1)
+}
+
+func TestVersionsAndCipherSuites(t *testing.T) {
+	c := &Config{MinVersion: "1.2", MaxVersion: "1.3", CipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	config, err := c.ClientConfig(log.RootLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MaxVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+
+	c = &Config{MinVersion: "1.3", MaxVersion: "1.2"}
+	_, err = c.ClientConfig(log.RootLogger())
+	assert.NotNil(t, err)
+
+	c = &Config{CipherSuites: "TLS_UNKNOWN"}
+	_, err = c.ClientConfig(log.RootLogger())
+	assert.NotNil(t, err)
+}
+
+func TestServerCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	certPEM, keyPEM := generateCert(t, "first")
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+
+	c := &Config{Cert: certFile, Key: keyFile, ReloadInterval: time.Millisecond}
+	config, err := c.ServerConfig(log.RootLogger())
+	assert.Nil(t, err)
+
+	commonName := func() string {
+		cert, err := config.GetCertificate(nil)
+		assert.Nil(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.Nil(t, err)
+		return parsed.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	certPEM, keyPEM = generateCert(t, "second")
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, later, later))
+	assert.Nil(t, os.Chtimes(keyFile, later, later))
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, "second", commonName())
+}
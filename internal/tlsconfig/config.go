@@ -0,0 +1,150 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+// Config holds the TLS options shared by the websocket triggers and activities
+type Config struct {
+	// AllowInsecure skips verification of the peer certificate (client only)
+	AllowInsecure bool
+	// CaCert is the trust store used to verify the peer
+	CaCert string
+	// Cert and Key are the own certificate and private key; Key may be empty
+	// when Cert is a PEM bundle or a PKCS#12 archive
+	Cert string
+	Key  string
+	// Password decrypts PKCS#12 archives
+	Password string
+	// MinVersion and MaxVersion accept "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string
+	MaxVersion string
+	// CipherSuites is a comma separated list of cipher suite names
+	CipherSuites string
+	// ClientAuth requires and verifies client certificates (server only)
+	ClientAuth bool
+	// ReloadInterval is how often the server certificate files are checked
+	// for changes, zero disables reloading (server only)
+	ReloadInterval time.Duration
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ClientConfig builds the TLS configuration used to dial a websocket server
+func (c *Config) ClientConfig(logger log.Logger) (*tls.Config, error) {
+	config := &tls.Config{}
+	if err := c.applyCommon(config); err != nil {
+		return nil, err
+	}
+	if c.AllowInsecure {
+		config.InsecureSkipVerify = true
+	} else if c.CaCert != "" {
+		certPool, err := LoadCertPool(c.CaCert, c.Password, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Error while loading client trust store - %v", err)
+		}
+		config.RootCAs = certPool
+	}
+	if c.Cert != "" {
+		cert, err := LoadKeyPair(c.Cert, c.Key, c.Password, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Error while loading client certificate - %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ServerConfig builds the TLS configuration used by a websocket server. When
+// the certificate is read from files and ReloadInterval is set, rotated
+// certificates are picked up without restarting the server
+func (c *Config) ServerConfig(logger log.Logger) (*tls.Config, error) {
+	if c.Cert == "" {
+		return nil, fmt.Errorf("No server certificate configured")
+	}
+	config := &tls.Config{}
+	if err := c.applyCommon(config); err != nil {
+		return nil, err
+	}
+	reloader, err := newCertReloader(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	config.GetCertificate = reloader.GetCertificate
+	if c.ClientAuth {
+		if c.CaCert == "" {
+			return nil, fmt.Errorf("Client auth is enabled but client trust store is not provided")
+		}
+		certPool, err := LoadCertPool(c.CaCert, c.Password, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Error while loading client trust store - %v", err)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = certPool
+	}
+	return config, nil
+}
+
+func (c *Config) applyCommon(config *tls.Config) error {
+	var err error
+	if config.MinVersion, err = parseVersion(c.MinVersion); err != nil {
+		return err
+	}
+	if config.MaxVersion, err = parseVersion(c.MaxVersion); err != nil {
+		return err
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return fmt.Errorf("Minimum TLS version [%s] is greater than maximum TLS version [%s]", c.MinVersion, c.MaxVersion)
+	}
+	config.CipherSuites, err = parseCipherSuites(c.CipherSuites)
+	return err
+}
+
+func parseVersion(version string) (uint16, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "TLS")
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported TLS version [%s]", version)
+	}
+	return v, nil
+}
+
+func parseCipherSuites(names string) ([]uint16, error) {
+	if strings.TrimSpace(names) == "" {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported cipher suite [%s]", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,77 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+// certReloader serves the server certificate and reloads it when the
+// underlying files change on disk
+type certReloader struct {
+	config    *Config
+	logger    log.Logger
+	files     []string
+	modTimes  []time.Time
+	lastCheck time.Time
+	cert      *tls.Certificate
+	sync.Mutex
+}
+
+func newCertReloader(c *Config, logger log.Logger) (*certReloader, error) {
+	cert, err := LoadKeyPair(c.Cert, c.Key, c.Password, logger)
+	if err != nil {
+		return nil, err
+	}
+	r := &certReloader{config: c, logger: logger, cert: &cert, lastCheck: time.Now()}
+	if c.ReloadInterval > 0 {
+		for _, name := range []string{c.Cert, c.Key} {
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				r.files = append(r.files, name)
+				r.modTimes = append(r.modTimes, info.ModTime())
+			}
+		}
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.files) == 0 || time.Since(r.lastCheck) < r.config.ReloadInterval {
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+	changed := false
+	for i, name := range r.files {
+		info, err := os.Stat(name)
+		if err != nil {
+			r.logger.Warnf("Unable to check server certificate file [%s] for changes - %v", name, err)
+			return r.cert, nil
+		}
+		if !info.ModTime().Equal(r.modTimes[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return r.cert, nil
+	}
+	cert, err := LoadKeyPair(r.config.Cert, r.config.Key, r.config.Password, r.logger)
+	if err != nil {
+		// keep serving the previous certificate, the rotation may be in progress
+		r.logger.Warnf("Error while reloading server certificate - %v", err)
+		return r.cert, nil
+	}
+	for i, name := range r.files {
+		if info, err := os.Stat(name); err == nil {
+			r.modTimes[i] = info.ModTime()
+		}
+	}
+	r.cert = &cert
+	r.logger.Info("Reloaded rotated server certificate")
+	return r.cert, nil
+}
@@ -0,0 +1,390 @@
+package wsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/websocket/internal/handshake"
+	"github.com/project-flogo/websocket/internal/heartbeat"
+	"github.com/project-flogo/websocket/internal/oauth"
+	"github.com/project-flogo/websocket/wslock"
+)
+
+// connection is one of the websocket connections opened by the trigger along
+// with its subscription messages and reconnect state
+type connection struct {
+	index     int
+	t         *Trigger
+	wsconn    *websocket.Conn
+	onConnect [][]byte
+	retry     *retry
+	endpoint  *endpoint
+	planned   bool
+	pingdone  chan bool
+	heartbeat *heartbeat.Monitor
+	hbdone    chan struct{}
+	closeErr  error
+	renewal   *time.Timer
+	response  map[string]interface{}
+	fresh     bool
+	mu        sync.Mutex
+}
+
+// newConnection creates the connection with the supplied index, it gets the
+// common on connect messages followed by its own slice of the sharded messages
+func newConnection(t *Trigger, index int) *connection {
+	c := &connection{index: index, t: t, retry: newRetry(t.settings)}
+	c.onConnect = append(c.onConnect, t.onConnect...)
+	count := t.settings.Connections
+	from, to := index*len(t.shards)/count, (index+1)*len(t.shards)/count
+	c.onConnect = append(c.onConnect, t.shards[from:to]...)
+	return c
+}
+
+func (c *connection) connect() error {
+	ep := c.t.endpoints.pick()
+	err := c.dial(ep.url)
+	if err != nil {
+		c.t.endpoints.failure(ep, err)
+		return err
+	}
+	c.t.endpoints.success(ep)
+	c.mu.Lock()
+	c.endpoint = ep
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *connection) dial(urlstring string) error {
+	t := c.t
+	t.logger.Infof("[ %s ] dialing websocket endpoint [%s] for connection [%d]...", t.config.Id, urlstring, c.index)
+	// the dialed url may carry the access token, it is not logged
+	dialURL, header, token, err := t.handshake(urlstring)
+	if err != nil {
+		return err
+	}
+	t.logger.Debugf("[ %s ] dialing websocket endpoint with headers [%s]...", t.config.Id, t.header)
+	conn, res, err := t.dialer.Dial(dialURL, header)
+	if err != nil {
+		if res != nil {
+			if t.tokens != nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+				// fetch a new token for the next attempt
+				t.tokens.Invalidate()
+			}
+			defer res.Body.Close()
+			body, err1 := ioutil.ReadAll(res.Body)
+			if err1 != nil {
+				t.logger.Errorf("response code is: %v , error while reading response payload is: %s ", res.StatusCode, err1)
+			}
+			t.logger.Errorf("response code is: %v , payload is: %s , error is: %s", res.StatusCode, string(body), err)
+		}
+		return fmt.Errorf("error while connecting to websocket endpoint[%s] - %s", urlstring, err)
+	}
+	err = c.sendOnConnectMessages(conn)
+	if err != nil {
+		conn.Close()
+		wslock.Release(conn)
+		return fmt.Errorf("error while subscribing to websocket endpoint[%s] - %s", urlstring, err)
+	}
+	c.mu.Lock()
+	c.wsconn = conn
+	// handed over to the connected event and the first received message
+	c.response, c.fresh = handshake.Response(res), true
+	c.mu.Unlock()
+	if token != nil {
+		c.scheduleRenewal(conn, token)
+	}
+	t.logger.Infof("websocket connection [%p] established successfully", conn)
+	return nil
+}
+
+// sendOnConnectMessages replays the configured subscription/handshake messages
+// on a newly established connection and optionally waits for the acknowledgement
+func (c *connection) sendOnConnectMessages(conn *websocket.Conn) error {
+	t := c.t
+	if len(c.onConnect) == 0 {
+		return nil
+	}
+	for _, message := range c.onConnect {
+		t.logger.Debugf("sending on connect message: %s", message)
+		err := c.write(conn, message)
+		if err != nil {
+			return err
+		}
+	}
+	ack := t.settings.OnConnectAck
+	if ack == "" {
+		return nil
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Duration(t.settings.OnConnectAckTimeout) * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("acknowledgement [%s] not received - %s", ack, err)
+		}
+		if strings.Contains(string(message), ack) {
+			t.logger.Debugf("received on connect acknowledgement: %s", message)
+			return nil
+		}
+		t.logger.Debugf("discarding message received before on connect acknowledgement: %s", message)
+	}
+}
+
+func (c *connection) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wsconn != nil {
+		select {
+		case c.pingdone <- true:
+			c.t.logger.Debug("Sending pingdone signal to deactivate ping service for this connection")
+		default:
+			c.t.logger.Debug("No active ping service so signal not sent")
+		}
+		if c.hbdone != nil {
+			close(c.hbdone)
+			c.hbdone = nil
+		}
+		if c.renewal != nil {
+			c.renewal.Stop()
+			c.renewal = nil
+		}
+		c.wsconn.Close()
+		wslock.Release(c.wsconn)
+	}
+}
+
+// listen reads messages and dispatches them to the handlers, reconnecting
+// according to the reconnect policy when the connection is lost
+func (c *connection) listen() {
+	t := c.t
+	defer func() {
+		if c.wsconn != nil {
+			text := []byte("Sending close message while getting out of reading connection loop")
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, string(text))
+			err := c.wsconn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+			if err != nil {
+				t.logger.Warnf("Received error [%s] while writing close message", err)
+			}
+			t.logger.Info("Closing connection while going out of trigger handler")
+			c.close()
+		}
+	}()
+	if c.wsconn == nil {
+		// initial connection failed, keep trying in the background
+		if !c.reconnect() {
+			return
+		}
+	}
+	maxSilence := time.Duration(t.settings.MaxSilence) * time.Second
+	lastData := time.Now()
+	for {
+		if maxSilence > 0 {
+			// control frames and heartbeat responses don't extend the deadline
+			c.wsconn.SetReadDeadline(lastData.Add(maxSilence))
+		}
+		mt, message, err := c.wsconn.ReadMessage()
+		if err != nil {
+			if t.stopped() {
+				break
+			}
+			c.mu.Lock()
+			if c.closeErr != nil {
+				// report why the connection was closed locally
+				err, c.closeErr = c.closeErr, nil
+			}
+			c.mu.Unlock()
+			if e, ok := err.(net.Error); ok && e.Timeout() && maxSilence > 0 {
+				err = fmt.Errorf("no message received within %s", maxSilence)
+				t.logger.Warnf("stale websocket feed on connection [%d], %s", c.index, err)
+				t.fireEvent(c, EventStale, 0, err)
+			}
+			t.logger.Errorf("error while reading websocket message: %s", err)
+			t.fireEvent(c, EventDisconnected, 0, err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				break
+			}
+			c.retry.disconnected(err)
+			c.mu.Lock()
+			if c.planned {
+				c.planned = false
+			} else if c.endpoint != nil {
+				t.endpoints.failure(c.endpoint, err)
+			}
+			c.mu.Unlock()
+			if !c.reconnect() {
+				break
+			}
+			lastData = time.Now()
+			continue
+		}
+		if c.heartbeat != nil && c.heartbeat.Received(message) {
+			t.logger.Debugf("received heartbeat response: %s", message)
+			continue
+		}
+		lastData = time.Now()
+		t.logger.Debug("New message received...")
+		out := &Output{Event: EventMessage, Connection: c.index}
+		var content interface{}
+		if (t.config.Settings["format"] != nil && t.config.Settings["format"].(string) == "JSON") ||
+			(t.config.Settings["format"] == nil && isJSON(message)) {
+			err := json.NewDecoder(bytes.NewBuffer(message)).Decode(&content)
+			if err != nil {
+				t.logger.Errorf("error while decoding websocket message of JSON type : %s", err)
+				break
+			}
+		} else {
+			content = string(message)
+		}
+		out.Content = content
+		out.WSconnection = c.wsconn
+		c.mu.Lock()
+		if c.fresh {
+			out.Handshake, c.fresh = c.response, false
+		}
+		c.mu.Unlock()
+		m := &received{out: out, mt: mt, subprotocol: c.wsconn.Subprotocol()}
+		if t.dispatcher != nil {
+			t.dispatcher.dispatch(m)
+		} else {
+			t.handle(m)
+		}
+	}
+	t.logger.Infof("stopped listening to websocket endpoint for connection [%d]", c.index)
+}
+
+// reconnect re-establishes the connection, it returns false when the trigger
+// gives up or got stopped
+func (c *connection) reconnect() bool {
+	t := c.t
+	t.logger.Debugf("going to retry for connection [%d]", c.index)
+	err := c.retry.closeAndReconnect(c)
+	if err == errStopped {
+		return false
+	}
+	if err != nil {
+		t.logger.Errorf("Connection error after max retry : %s", err)
+		t.fireEvent(c, EventFailed, c.retry.attempts, c.retry.lastErr)
+		return false
+	}
+	c.startPingSetPongHandler()
+	return true
+}
+
+func (c *connection) startPingSetPongHandler() {
+	if c.wsconn != nil {
+		c.wsconn.SetPongHandler(func(msg string) error {
+			c.t.logger.Debugf("received pong msg from server: %s", msg)
+			return nil
+		})
+		// send ping to avoid TCI connection timeout
+		pingdone := make(chan bool)
+		go c.ping(c.wsconn, pingdone)
+		c.pingdone = pingdone
+		if c.t.heartbeat != nil {
+			c.startHeartbeat(c.wsconn)
+		}
+	}
+}
+
+// startHeartbeat sends the application level heartbeat on the connection and
+// closes it when the response doesn't arrive in time, which makes the listener
+// reconnect
+func (c *connection) startHeartbeat(conn *websocket.Conn) {
+	monitor := c.t.heartbeat.Monitor()
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.heartbeat = monitor
+	c.hbdone = done
+	c.mu.Unlock()
+	go func() {
+		err := monitor.Run(func(message []byte) error {
+			c.t.logger.Debugf("sending heartbeat: %s", message)
+			return c.write(conn, message)
+		}, done)
+		if err != nil {
+			c.closeWith(conn, false, err)
+		}
+	}()
+}
+
+// write sends a text message, it shares the write lock of the connection with
+// the flows writing to the wsconnection output
+func (c *connection) write(conn *websocket.Conn, message []byte) error {
+	return wslock.WriteMessage(conn, websocket.TextMessage, message)
+}
+
+// closeWith closes the connection to make the listener reconnect, err is
+// reported as the reason. A planned close is not an endpoint failure
+func (c *connection) closeWith(conn *websocket.Conn, planned bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wsconn != conn {
+		// already replaced by a new connection
+		return
+	}
+	c.t.logger.Infof("closing connection [%d] - %s", c.index, err)
+	c.planned = planned
+	c.closeErr = err
+	conn.Close()
+	wslock.Release(conn)
+}
+
+// scheduleRenewal reconnects before the access token of the connection expires
+func (c *connection) scheduleRenewal(conn *websocket.Conn, token *oauth.Token) {
+	if token.Expiry.IsZero() {
+		return
+	}
+	d := time.Until(token.Expiry) - time.Duration(c.t.settings.OAuthRenewBefore)*time.Second
+	if d <= 0 {
+		c.t.logger.Warnf("access token expires in less than oauthRenewBefore, connection [%d] is not renewed", c.index)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.renewal != nil {
+		c.renewal.Stop()
+	}
+	c.renewal = time.AfterFunc(d, func() {
+		c.closeWith(conn, true, errors.New("renewing connection before the access token expires"))
+	})
+}
+
+func (c *connection) ping(conn *websocket.Conn, done chan bool) {
+	tr := c.t
+	tr.logger.Debugf("starting ping ticker for conn: %p ", conn)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case t := <-ticker.C:
+			tr.logger.Debugf("Sending Ping at timestamp : %v", t)
+			if err := conn.WriteControl(websocket.PingMessage, []byte("---HeartBeat---"), time.Now().Add(time.Second)); err != nil {
+				tr.logger.Errorf("error while sending ping: %v", err)
+				var ErrCloseSent = errors.New("websocket: close sent")
+				if err != ErrCloseSent {
+					e, ok := err.(net.Error)
+					if !ok || !e.Temporary() {
+						tr.logger.Debugf("stopping ping ticker for conn: %p as received non temporary error while sending ping: %s ", conn, err.Error())
+						return
+					}
+				}
+			}
+		case <-done:
+			tr.logger.Debugf("stopping ping ticker for conn: %p as seems connection being releaved", conn)
+			return
+		case <-tr.done:
+			tr.logger.Debugf("stopping ping ticker for conn: %p while engine getting stopped", conn)
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package wsclient
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionShards(t *testing.T) {
+	tr := &Trigger{
+		settings:  &Settings{Connections: 3},
+		onConnect: [][]byte{[]byte("auth")},
+		shards:    [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")},
+	}
+	var got [][]string
+	for i := 0; i < 3; i++ {
+		var messages []string
+		for _, m := range newConnection(tr, i).onConnect {
+			messages = append(messages, string(m))
+		}
+		got = append(got, messages)
+	}
+	assert.Equal(t, [][]string{{"auth", "a"}, {"auth", "b", "c"}, {"auth", "d", "e"}}, got)
+}
+
+func TestOnConnectResend(t *testing.T) {
+	subscriptions := make(chan []string, 10)
+	var connections int32
+	url := wsServer(t, func(conn *websocket.Conn) {
+		n := atomic.AddInt32(&connections, 1)
+		var received []string
+		for i := 0; i < 2; i++ {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received = append(received, string(message))
+		}
+		subscriptions <- received
+		conn.WriteMessage(websocket.TextMessage, []byte("before acknowledgement"))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"status":"subscribed"}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("update %d", n)))
+		if n == 1 {
+			// drop the first connection
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	data := newTestHandler(ModeData)
+	startTrigger(t, map[string]interface{}{
+		"url":                   url,
+		"onConnectMessages":     []interface{}{"auth", map[string]interface{}{"op": "subscribe"}},
+		"onConnectAck":          "subscribed",
+		"autoReconnectAttempts": 3,
+	}, data)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case received := <-subscriptions:
+			assert.Equal(t, []string{"auth", `{"op":"subscribe"}`}, received, "connection %d", i+1)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("on connect messages of connection %d not received", i+1)
+		}
+	}
+	for _, expected := range []string{"update 1", "update 2"} {
+		select {
+		case out := <-data.outputs:
+			assert.Equal(t, expected, out.Content, "messages before the acknowledgement are discarded")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message [%s] not dispatched", expected)
+		}
+	}
+}
+
+func TestOnConnectAckTimeout(t *testing.T) {
+	url := wsServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte("not an acknowledgement"))
+		}
+	})
+	tr := &Trigger{settings: &Settings{OnConnectAck: "subscribed", OnConnectAckTimeout: 1}, logger: log.RootLogger()}
+	c := &connection{t: tr, onConnect: [][]byte{[]byte("subscribe")}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	err = c.sendOnConnectMessages(conn)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "acknowledgement [subscribed] not received")
+	}
+	assert.True(t, time.Since(start) >= time.Second, "waits for onConnectAckTimeout")
+}
+
+func TestMaxSilence(t *testing.T) {
+	var connections, heartbeats int32
+	url := wsServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&connections, 1)
+		var mu sync.Mutex
+		write := func(mt int, data string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if mt == websocket.TextMessage {
+				conn.WriteMessage(mt, []byte(data))
+				return
+			}
+			conn.WriteControl(mt, []byte(data), time.Now().Add(time.Second))
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			// control frames keep flowing while the feed is silent
+			ticker := time.NewTicker(100 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					write(websocket.PingMessage, "ping")
+					write(websocket.PongMessage, "pong")
+				case <-done:
+					return
+				}
+			}
+		}()
+		write(websocket.TextMessage, "hello")
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(message) == "heartbeat" {
+				atomic.AddInt32(&heartbeats, 1)
+				write(websocket.TextMessage, "heartbeat-ack")
+			}
+		}
+	})
+	events := newTestHandler(ModeEvents)
+	startTrigger(t, map[string]interface{}{
+		"url":                       url,
+		"maxSilence":                2,
+		"heartbeatMessage":          "heartbeat",
+		"heartbeatResponse":         "heartbeat-ack",
+		"heartbeatInterval":         1,
+		"autoReconnectAttempts":     3,
+		"autoReconnectInitialDelay": 0,
+		"autoReconnectMaxDelay":     0,
+		"failbackInterval":          0,
+	}, events)
+
+	var got []string
+	var stale *Output
+	timeout := time.After(6 * time.Second)
+	for {
+		select {
+		case out := <-events.outputs:
+			got = append(got, out.Event)
+			if out.Event == EventStale {
+				stale = out
+			}
+			if out.Event != EventConnected || out.Attempt == 0 {
+				continue
+			}
+		case <-timeout:
+			t.Fatalf("no reconnect after stale feed, events %v", got)
+		}
+		break
+	}
+	assert.Equal(t, []string{EventConnected, EventStale, EventDisconnected, EventReconnecting, EventConnected}, got,
+		"pings, pongs and heartbeat responses don't reset the silence timer")
+	if assert.NotNil(t, stale) {
+		assert.Equal(t, "no message received within 2s", stale.Error)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+	assert.True(t, atomic.LoadInt32(&heartbeats) > 0, "heartbeats were answered before the feed went stale")
+}
@@ -0,0 +1,163 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/project-flogo/websocket/internal/jsonpath"
+)
+
+const (
+	// DispatchSerial handles every message inside the read loop
+	DispatchSerial = "Serial"
+	// DispatchConcurrent hands the messages over to a pool of workers
+	DispatchConcurrent = "Concurrent"
+)
+
+const (
+	// OverflowBlock stops reading until the queue has room again
+	OverflowBlock = "Block"
+	// OverflowDropNewest discards the received message when the queue is full
+	OverflowDropNewest = "DropNewest"
+	// OverflowDropOldest discards the longest waiting message when the queue is full
+	OverflowDropOldest = "DropOldest"
+)
+
+// received is a message waiting to be dispatched to the handlers
+type received struct {
+	out         *Output
+	mt          int
+	subprotocol string
+}
+
+// dispatcher decouples reading from flow execution. Without an order key all
+// workers share a single queue, otherwise every worker owns a queue and
+// messages with the same key always go to the same worker to keep their order
+type dispatcher struct {
+	t        *Trigger
+	queues   []chan *received
+	workers  int
+	key      jsonpath.Path
+	overflow string
+	next     uint32
+}
+
+// newDispatcher returns nil when messages are handled serially
+func newDispatcher(t *Trigger, s *Settings) (*dispatcher, error) {
+	switch {
+	case s.DispatchMode == "" || strings.EqualFold(s.DispatchMode, DispatchSerial):
+		return nil, nil
+	case !strings.EqualFold(s.DispatchMode, DispatchConcurrent):
+		return nil, fmt.Errorf("unsupported dispatchMode [%s]", s.DispatchMode)
+	}
+	d := &dispatcher{t: t, workers: s.DispatchWorkers}
+	if d.workers <= 0 {
+		return nil, fmt.Errorf("dispatchWorkers must be greater than 0")
+	}
+	switch {
+	case s.DispatchOverflow == "" || strings.EqualFold(s.DispatchOverflow, OverflowBlock):
+		d.overflow = OverflowBlock
+	case strings.EqualFold(s.DispatchOverflow, OverflowDropNewest):
+		d.overflow = OverflowDropNewest
+	case strings.EqualFold(s.DispatchOverflow, OverflowDropOldest):
+		d.overflow = OverflowDropOldest
+	default:
+		return nil, fmt.Errorf("unsupported dispatchOverflow [%s]", s.DispatchOverflow)
+	}
+	queues := 1
+	if s.DispatchOrderKey != "" {
+		key, err := jsonpath.Compile(s.DispatchOrderKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dispatchOrderKey - %s", err)
+		}
+		d.key = key
+		queues = d.workers
+	}
+	size := s.DispatchQueueSize / queues
+	if size < 1 {
+		size = 1
+	}
+	for i := 0; i < queues; i++ {
+		d.queues = append(d.queues, make(chan *received, size))
+	}
+	return d, nil
+}
+
+// start launches the workers, they run until the trigger is stopped
+func (d *dispatcher) start() {
+	for i := 0; i < d.workers; i++ {
+		go d.work(d.queues[i%len(d.queues)])
+	}
+}
+
+func (d *dispatcher) work(queue chan *received) {
+	for {
+		select {
+		case m := <-queue:
+			d.t.handle(m)
+		case <-d.t.done:
+			return
+		}
+	}
+}
+
+// queue returns the queue of the message, messages without the order key
+// are spread across the workers
+func (d *dispatcher) queue(m *received) chan *received {
+	if len(d.queues) == 1 {
+		return d.queues[0]
+	}
+	if value, ok := d.key.Get(m.out.Content); ok {
+		h := fnv.New32a()
+		h.Write([]byte(fmt.Sprint(value)))
+		return d.queues[h.Sum32()%uint32(len(d.queues))]
+	}
+	return d.queues[atomic.AddUint32(&d.next, 1)%uint32(len(d.queues))]
+}
+
+// dispatch enqueues the message according to the overflow policy
+func (d *dispatcher) dispatch(m *received) {
+	queue := d.queue(m)
+	switch d.overflow {
+	case OverflowBlock:
+		select {
+		case queue <- m:
+		case <-d.t.done:
+		}
+	case OverflowDropNewest:
+		select {
+		case queue <- m:
+		default:
+			d.t.logger.Warnf("dispatch queue full, dropping received message of connection [%d]", m.out.Connection)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- m:
+				return
+			default:
+			}
+			select {
+			case old := <-queue:
+				d.t.logger.Warnf("dispatch queue full, dropping oldest message of connection [%d]", old.out.Connection)
+			default:
+			}
+		}
+	}
+}
+
+// handle dispatches the message to the handlers in Data mode whose filter matches
+func (t *Trigger) handle(m *received) {
+	for _, h := range t.handlers {
+		if h.mode != ModeData || !h.filter.matches(m.mt, m.out.Content, m.subprotocol) {
+			continue
+		}
+		_, err := h.handler.Handle(context.Background(), m.out)
+		if err != nil {
+			t.logger.Errorf("Run action  failed [%s] ", err)
+		}
+	}
+}
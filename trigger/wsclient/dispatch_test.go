@@ -0,0 +1,103 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/websocket/wslock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcherOrderKey(t *testing.T) {
+	tr := &Trigger{logger: log.RootLogger(), done: make(chan struct{})}
+	d, err := newDispatcher(tr, &Settings{DispatchMode: "concurrent", DispatchWorkers: 4, DispatchQueueSize: 40, DispatchOrderKey: "$.symbol"})
+	assert.Nil(t, err)
+	assert.Len(t, d.queues, 4)
+
+	msg := func(symbol string) *received {
+		return &received{out: &Output{Content: map[string]interface{}{"symbol": symbol}}}
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, d.queue(msg("ABC")), d.queue(msg("ABC")), "same key must go to the same worker")
+	}
+
+	d, err = newDispatcher(tr, &Settings{DispatchWorkers: 4})
+	assert.Nil(t, err)
+	assert.Nil(t, d, "serial dispatch by default")
+
+	_, err = newDispatcher(tr, &Settings{DispatchMode: "Parallel", DispatchWorkers: 4})
+	assert.NotNil(t, err)
+	_, err = newDispatcher(tr, &Settings{DispatchMode: DispatchConcurrent, DispatchWorkers: 4, DispatchOverflow: "Spill"})
+	assert.NotNil(t, err)
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	tr := &Trigger{logger: log.RootLogger(), done: make(chan struct{})}
+	for policy, expected := range map[string][]int{OverflowDropNewest: {0, 1}, OverflowDropOldest: {2, 3}} {
+		d, err := newDispatcher(tr, &Settings{DispatchMode: DispatchConcurrent, DispatchWorkers: 1, DispatchQueueSize: 2, DispatchOverflow: policy})
+		assert.Nil(t, err)
+		for i := 0; i < 4; i++ {
+			d.dispatch(&received{out: &Output{Content: i}})
+		}
+		var queued []int
+		for len(d.queues[0]) > 0 {
+			queued = append(queued, (<-d.queues[0]).out.Content.(int))
+		}
+		assert.Equal(t, expected, queued, policy)
+	}
+}
+
+// replyHandler answers every received message on the connection of the trigger
+type replyHandler struct {
+	*testHandler
+}
+
+func (h *replyHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	out := triggerData.(*Output)
+	return nil, wslock.WriteMessage(out.WSconnection.(*websocket.Conn), websocket.TextMessage, []byte(fmt.Sprint("reply-", out.Content)))
+}
+
+func TestDispatcherConcurrentWrites(t *testing.T) {
+	const messages = 200
+	var replies, heartbeats int32
+	done := make(chan struct{})
+	url := wsServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < messages; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprint(i)))
+		}
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(message) == "heartbeat" {
+				atomic.AddInt32(&heartbeats, 1)
+				continue
+			}
+			if atomic.AddInt32(&replies, 1) == messages {
+				close(done)
+			}
+		}
+	})
+	startTrigger(t, map[string]interface{}{
+		"url":               url,
+		"format":            "String",
+		"dispatchMode":      DispatchConcurrent,
+		"dispatchWorkers":   8,
+		"heartbeatMessage":  "heartbeat",
+		"heartbeatInterval": 1,
+	}, &replyHandler{newTestHandler(ModeData)})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("received %d of %d replies", atomic.LoadInt32(&replies), messages)
+	}
+	// the heartbeat shares the write lock with the flows
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&heartbeats) > 0 }, 3*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,122 @@
+package wsclient
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FailoverPriority always connects to the first healthy endpoint in the configured order
+	FailoverPriority = "Priority"
+	// FailoverRoundRobin connects to the endpoints in turn
+	FailoverRoundRobin = "RoundRobin"
+	// FailoverRandom connects to a random healthy endpoint
+	FailoverRandom = "Random"
+)
+
+// endpoint is a websocket url along with its health
+type endpoint struct {
+	url         string
+	failures    int
+	lastFailure time.Time
+	lastErr     error
+}
+
+// endpoints selects the url to connect to according to the failover
+// strategy, endpoints which failed recently are skipped as long as a
+// healthy one is available
+type endpoints struct {
+	list       []*endpoint
+	strategy   string
+	quarantine time.Duration
+	next       int
+	sync.Mutex
+}
+
+func newEndpoints(urls []string, strategy string, quarantine time.Duration) (*endpoints, error) {
+	e := &endpoints{quarantine: quarantine}
+	switch {
+	case strategy == "" || strings.EqualFold(strategy, FailoverPriority):
+		e.strategy = FailoverPriority
+	case strings.EqualFold(strategy, FailoverRoundRobin):
+		e.strategy = FailoverRoundRobin
+	case strings.EqualFold(strategy, FailoverRandom):
+		e.strategy = FailoverRandom
+	default:
+		return nil, fmt.Errorf("unsupported failoverStrategy [%s]", strategy)
+	}
+	for _, u := range urls {
+		e.list = append(e.list, &endpoint{url: u})
+	}
+	return e, nil
+}
+
+func (e *endpoints) healthy(ep *endpoint) bool {
+	return ep.failures == 0 || time.Since(ep.lastFailure) >= e.quarantine
+}
+
+// pick returns the endpoint for the next connection attempt
+func (e *endpoints) pick() *endpoint {
+	e.Lock()
+	defer e.Unlock()
+	var healthy []int
+	for i, ep := range e.list {
+		if e.healthy(ep) {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) == 0 {
+		// everything failed recently, keep cycling through all of them
+		for i := range e.list {
+			healthy = append(healthy, i)
+		}
+	}
+	var index int
+	switch e.strategy {
+	case FailoverPriority:
+		index = healthy[0]
+	case FailoverRoundRobin:
+		index = healthy[0]
+		for _, i := range healthy {
+			if i >= e.next {
+				index = i
+				break
+			}
+		}
+		e.next = index + 1
+	case FailoverRandom:
+		index = healthy[rand.Intn(len(healthy))]
+	}
+	return e.list[index]
+}
+
+// success records a successful connection to the endpoint
+func (e *endpoints) success(ep *endpoint) {
+	e.Lock()
+	defer e.Unlock()
+	ep.failures = 0
+	ep.lastErr = nil
+}
+
+// failure records a failed connection or the loss of the connection to the endpoint
+func (e *endpoints) failure(ep *endpoint, err error) {
+	e.Lock()
+	defer e.Unlock()
+	ep.failures++
+	ep.lastFailure = time.Now()
+	ep.lastErr = err
+}
+
+// primary returns the first endpoint when it is a better one than the
+// current endpoint of a connection to fail back to
+func (e *endpoints) primary(current *endpoint) *endpoint {
+	e.Lock()
+	defer e.Unlock()
+	if e.strategy != FailoverPriority || len(e.list) < 2 || current == nil || current == e.list[0] {
+		return nil
+	}
+	return e.list[0]
+}
@@ -0,0 +1,94 @@
+package wsclient
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointsPriority(t *testing.T) {
+	e, err := newEndpoints([]string{"ws://primary", "ws://secondary"}, FailoverPriority, time.Minute)
+	assert.Nil(t, err)
+
+	primary := e.pick()
+	assert.Equal(t, "ws://primary", primary.url)
+	assert.Nil(t, e.primary(primary))
+
+	e.failure(primary, errors.New("lost"))
+	secondary := e.pick()
+	assert.Equal(t, "ws://secondary", secondary.url)
+	assert.Equal(t, primary, e.primary(secondary))
+
+	e.failure(secondary, errors.New("lost"))
+	assert.Equal(t, "ws://primary", e.pick().url, "all endpoints failed, start over")
+
+	e.success(primary)
+	assert.Equal(t, "ws://primary", e.pick().url)
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	e, err := newEndpoints([]string{"ws://a", "ws://b", "ws://c"}, "roundrobin", time.Minute)
+	assert.Nil(t, err)
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, e.pick().url)
+	}
+	assert.Equal(t, []string{"ws://a", "ws://b", "ws://c", "ws://a"}, picked)
+
+	e.failure(e.list[1], errors.New("down"))
+	picked = nil
+	for i := 0; i < 3; i++ {
+		picked = append(picked, e.pick().url)
+	}
+	assert.Equal(t, []string{"ws://c", "ws://a", "ws://c"}, picked)
+	assert.Nil(t, e.primary(e.list[1]))
+}
+
+func TestEndpointsRandom(t *testing.T) {
+	e, err := newEndpoints([]string{"ws://a", "ws://b"}, FailoverRandom, time.Minute)
+	assert.Nil(t, err)
+	e.failure(e.list[0], errors.New("down"))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "ws://b", e.pick().url)
+	}
+
+	_, err = newEndpoints([]string{"ws://a"}, "Sticky", time.Minute)
+	assert.NotNil(t, err)
+}
+
+func TestFailoverWithoutFailback(t *testing.T) {
+	dead := httptest.NewServer(nil)
+	dead.Close()
+	secondary := wsServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	data := newTestHandler(ModeData)
+	tr := startTrigger(t, map[string]interface{}{
+		"url":                       "ws" + strings.TrimPrefix(dead.URL, "http"),
+		"failoverURLs":              []interface{}{secondary},
+		"failbackInterval":          0,
+		"autoReconnectAttempts":     3,
+		"autoReconnectInitialDelay": 0,
+		"autoReconnectMaxDelay":     0,
+	}, data)
+
+	select {
+	case out := <-data.outputs:
+		assert.Equal(t, "hello", out.Content)
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't fail over to the secondary url")
+	}
+	tr.conns[0].mu.Lock()
+	defer tr.conns[0].mu.Unlock()
+	assert.Equal(t, secondary, tr.conns[0].endpoint.url, "the failed primary url is skipped without failing back")
+}
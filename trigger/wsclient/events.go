@@ -0,0 +1,61 @@
+package wsclient
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+const (
+	// ModeData dispatches received messages to the handler
+	ModeData = "Data"
+	// ModeEvents dispatches connection state events to the handler
+	ModeEvents = "Events"
+)
+
+const (
+	// EventMessage is the event of a received message
+	EventMessage = "message"
+	// EventConnected is fired once the connection is (re)established
+	EventConnected = "connected"
+	// EventDisconnected is fired when the connection is lost
+	EventDisconnected = "disconnected"
+	// EventReconnecting is fired before every reconnect attempt
+	EventReconnecting = "reconnecting"
+	// EventFailed is fired once all reconnect attempts are exhausted
+	EventFailed = "failed"
+	// EventStale is fired when no message arrived within maxSilence
+	EventStale = "stale"
+)
+
+// fireEvent dispatches a connection state event of the supplied connection to
+// the handlers in Events mode
+func (t *Trigger) fireEvent(c *connection, event string, attempt int64, lastErr error) {
+	if atomic.LoadInt32(&t.started) == 0 {
+		return
+	}
+	t.logger.Debugf("firing connection event [%s] for connection [%d], attempt [%d]", event, c.index, attempt)
+	out := &Output{
+		Event:      event,
+		Attempt:    attempt,
+		Connection: c.index,
+	}
+	if lastErr != nil {
+		out.Error = lastErr.Error()
+	}
+	// reconnects replace the connection
+	c.mu.Lock()
+	out.WSconnection = c.wsconn
+	if event == EventConnected {
+		out.Handshake = c.response
+	}
+	c.mu.Unlock()
+	for _, h := range t.handlers {
+		if h.mode != ModeEvents {
+			continue
+		}
+		_, err := h.handler.Handle(context.Background(), out)
+		if err != nil {
+			t.logger.Errorf("Run action for connection event [%s] failed [%s] ", event, err)
+		}
+	}
+}
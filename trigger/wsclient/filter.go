@@ -0,0 +1,113 @@
+package wsclient
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/websocket/internal/jsonpath"
+)
+
+const (
+	// MessageTypeAny accepts text and binary messages
+	MessageTypeAny = "Any"
+	// MessageTypeText accepts text messages only
+	MessageTypeText = "Text"
+	// MessageTypeBinary accepts binary messages only
+	MessageTypeBinary = "Binary"
+)
+
+// eventFields lists where the event name is found for known subprotocols,
+// the default entry is used for anything else
+var eventFields = map[string][]jsonpath.Path{
+	"graphql-ws":           {{"type"}},
+	"graphql-transport-ws": {{"type"}},
+	"phoenix":              {{"event"}},
+	"actioncable-v1-json":  {{"type"}},
+	"wamp.2.json":          {{0}},
+	"":                     {{"event"}, {"type"}, {"op"}, {"action"}},
+}
+
+// messageFilter decides which messages are dispatched to a handler
+type messageFilter struct {
+	messageType int
+	path        jsonpath.Path
+	value       string
+	pattern     *regexp.Regexp
+	eventName   string
+}
+
+func newMessageFilter(s *HandlerSettings) (*messageFilter, error) {
+	f := &messageFilter{eventName: s.EventName}
+	switch {
+	case s.MessageType == "" || strings.EqualFold(s.MessageType, MessageTypeAny):
+	case strings.EqualFold(s.MessageType, MessageTypeText):
+		f.messageType = websocket.TextMessage
+	case strings.EqualFold(s.MessageType, MessageTypeBinary):
+		f.messageType = websocket.BinaryMessage
+	default:
+		return nil, fmt.Errorf("unsupported messageType [%s]", s.MessageType)
+	}
+	if s.JSONPath != "" {
+		path, err := jsonpath.Compile(s.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+		f.path = path
+		f.value = s.JSONValue
+		if s.JSONPattern != "" {
+			f.pattern, err = regexp.Compile(s.JSONPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonPattern [%s] - %s", s.JSONPattern, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether a message of the supplied type and decoded content
+// is accepted by the filter
+func (f *messageFilter) matches(messageType int, content interface{}, subprotocol string) bool {
+	if f.messageType != 0 && f.messageType != messageType {
+		return false
+	}
+	if f.path != nil {
+		value, ok := f.path.Get(content)
+		if !ok {
+			return false
+		}
+		str, err := coerce.ToString(value)
+		if err != nil {
+			return false
+		}
+		if f.value != "" && str != f.value {
+			return false
+		}
+		if f.pattern != nil && !f.pattern.MatchString(str) {
+			return false
+		}
+	}
+	if f.eventName != "" && eventName(content, subprotocol) != f.eventName {
+		return false
+	}
+	return true
+}
+
+// eventName extracts the event name of a message according to the
+// negotiated subprotocol
+func eventName(content interface{}, subprotocol string) string {
+	fields, ok := eventFields[subprotocol]
+	if !ok {
+		fields = eventFields[""]
+	}
+	for _, path := range fields {
+		if value, ok := path.Get(content); ok {
+			if name, err := coerce.ToString(value); err == nil && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package wsclient
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageFilter(t *testing.T) {
+	ticker := map[string]interface{}{
+		"event": "ticker",
+		"data":  []interface{}{map[string]interface{}{"symbol": "BTC-USD", "price": 100.5}},
+	}
+	parameters := []struct {
+		settings    HandlerSettings
+		messageType int
+		content     interface{}
+		subprotocol string
+		expected    bool
+	}{
+		{HandlerSettings{}, websocket.TextMessage, "plain", "", true},
+		{HandlerSettings{MessageType: MessageTypeBinary}, websocket.TextMessage, "plain", "", false},
+		{HandlerSettings{MessageType: MessageTypeText}, websocket.TextMessage, "plain", "", true},
+		{HandlerSettings{JSONPath: "$.data[0].symbol", JSONValue: "BTC-USD"}, websocket.TextMessage, ticker, "", true},
+		{HandlerSettings{JSONPath: "$.data[0].symbol", JSONValue: "ETH-USD"}, websocket.TextMessage, ticker, "", false},
+		{HandlerSettings{JSONPath: "$.data[0].symbol", JSONPattern: "^BTC-"}, websocket.TextMessage, ticker, "", true},
+		{HandlerSettings{JSONPath: "$.data[1].symbol"}, websocket.TextMessage, ticker, "", false},
+		{HandlerSettings{JSONPath: "$.data[0].price", JSONValue: "100.5"}, websocket.TextMessage, ticker, "", true},
+		{HandlerSettings{EventName: "ticker"}, websocket.TextMessage, ticker, "", true},
+		{HandlerSettings{EventName: "next"}, websocket.TextMessage, map[string]interface{}{"type": "next"}, "graphql-transport-ws", true},
+		{HandlerSettings{EventName: "ticker"}, websocket.TextMessage, ticker, "graphql-ws", false},
+	}
+	for i, p := range parameters {
+		f, err := newMessageFilter(&p.settings)
+		assert.Nil(t, err)
+		assert.Equal(t, p.expected, f.matches(p.messageType, p.content, p.subprotocol), "case %d", i)
+	}
+
+	_, err := newMessageFilter(&HandlerSettings{JSONPath: "$.a", JSONPattern: "("})
+	assert.NotNil(t, err)
+}
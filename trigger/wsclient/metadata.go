@@ -1,20 +1,69 @@
 package wsclient
 
+import "github.com/project-flogo/core/data/coerce"
+
 // Settings for the websocket client trigger
 type Settings struct {
-	URL                   string            `md:"url,required"`
-	AllowInsecure         bool              `md:"allowInsecure"`
-	CaCert                string            `md:"caCert"`
-	QueryParams           map[string]string `md:"queryParams"`
-	Headers               map[string]string `md:"headers"`
-	AutoReconnectAttempts int               `md:"autoReconnectAttempts"`
-	AutoReconnectMaxDelay int               `md:"autoReconnectMaxDelay"`
+	URL                       string            `md:"url,required"`
+	FailoverURLs              interface{}       `md:"failoverURLs"`
+	FailoverStrategy          string            `md:"failoverStrategy"`
+	FailbackInterval          int               `md:"failbackInterval"`
+	FailoverQuarantine        int               `md:"failoverQuarantine"`
+	AllowInsecure             bool              `md:"allowInsecure"`
+	CaCert                    string            `md:"caCert"`
+	ClientCert                string            `md:"clientCert"`
+	ClientKey                 string            `md:"clientKey"`
+	CertPassword              string            `md:"certPassword"`
+	MinTLSVersion             string            `md:"minTLSVersion"`
+	MaxTLSVersion             string            `md:"maxTLSVersion"`
+	CipherSuites              string            `md:"cipherSuites"`
+	ProxyURL                  string            `md:"proxyURL"`
+	ProxyUser                 string            `md:"proxyUser"`
+	ProxyPassword             string            `md:"proxyPassword"`
+	NoProxy                   string            `md:"noProxy"`
+	CookieJar                 bool              `md:"cookieJar"`
+	OAuthTokenURL             string            `md:"oauthTokenURL"`
+	OAuthClientID             string            `md:"oauthClientId"`
+	OAuthClientSecret         string            `md:"oauthClientSecret"`
+	OAuthScopes               string            `md:"oauthScopes"`
+	OAuthAuthStyle            string            `md:"oauthAuthStyle"`
+	OAuthTokenIn              string            `md:"oauthTokenIn"`
+	OAuthTokenName            string            `md:"oauthTokenName"`
+	OAuthRenewBefore          int               `md:"oauthRenewBefore"`
+	QueryParams               map[string]string `md:"queryParams"`
+	Headers                   map[string]string `md:"headers"`
+	AutoReconnectAttempts     int               `md:"autoReconnectAttempts"`
+	AutoReconnectMaxDelay     int               `md:"autoReconnectMaxDelay"`
+	AutoReconnectInitialDelay int               `md:"autoReconnectInitialDelay"`
+	AutoReconnectCoolDown     int               `md:"autoReconnectCoolDown"`
+	AutoReconnectResetAfter   int               `md:"autoReconnectResetAfter"`
+	Subprotocols              string            `md:"subprotocols"`
+	OnConnectMessages         interface{}       `md:"onConnectMessages"`
+	OnConnectAck              string            `md:"onConnectAck"`
+	OnConnectAckTimeout       int               `md:"onConnectAckTimeout"`
+	Connections               int               `md:"connections"`
+	ShardedMessages           interface{}       `md:"shardedMessages"`
+	DispatchMode              string            `md:"dispatchMode"`
+	DispatchWorkers           int               `md:"dispatchWorkers"`
+	DispatchOrderKey          string            `md:"dispatchOrderKey"`
+	DispatchQueueSize         int               `md:"dispatchQueueSize"`
+	DispatchOverflow          string            `md:"dispatchOverflow"`
+	HeartbeatMessage          string            `md:"heartbeatMessage"`
+	HeartbeatInterval         int               `md:"heartbeatInterval"`
+	HeartbeatResponse         string            `md:"heartbeatResponse"`
+	HeartbeatTimeout          int               `md:"heartbeatTimeout"`
+	MaxSilence                int               `md:"maxSilence"`
 }
 
 // Output is the outputs for the websocket trigger
 type Output struct {
 	Content      interface{} `md:"content"`
 	WSconnection interface{} `md:"wsconnection"`
+	Event        string      `md:"event"`
+	Attempt      int64       `md:"attempt"`
+	Error        string      `md:"error"`
+	Connection   int         `md:"connection"`
+	Handshake    interface{} `md:"handshake"`
 }
 
 // ToMap converts the output to a map
@@ -22,12 +71,45 @@ func (o *Output) ToMap() map[string]interface{} {
 	return map[string]interface{}{
 		"content":      o.Content,
 		"wsconnection": o.WSconnection,
+		"event":        o.Event,
+		"attempt":      o.Attempt,
+		"error":        o.Error,
+		"connection":   o.Connection,
+		"handshake":    o.Handshake,
 	}
 }
 
 // FromMap converts the values from a map to a struct
-func (o *Output) FromMap(values map[string]interface{}) error {
+func (o *Output) FromMap(values map[string]interface{}) (err error) {
 	o.Content = values["content"]
 	o.WSconnection = values["wsconnection"]
+	o.Event, err = coerce.ToString(values["event"])
+	if err != nil {
+		return err
+	}
+	o.Attempt, err = coerce.ToInt64(values["attempt"])
+	if err != nil {
+		return err
+	}
+	o.Error, err = coerce.ToString(values["error"])
+	if err != nil {
+		return err
+	}
+	o.Connection, err = coerce.ToInt(values["connection"])
+	if err != nil {
+		return err
+	}
+	o.Handshake = values["handshake"]
 	return nil
 }
+
+// HandlerSettings are the settings for a handler, they select whether messages
+// or connection state events are dispatched to it and filter the messages
+type HandlerSettings struct {
+	Mode        string `md:"mode"`
+	MessageType string `md:"messageType"`
+	JSONPath    string `md:"jsonPath"`
+	JSONValue   string `md:"jsonValue"`
+	JSONPattern string `md:"jsonPattern"`
+	EventName   string `md:"eventName"`
+}
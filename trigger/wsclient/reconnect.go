@@ -0,0 +1,122 @@
+package wsclient
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// errStopped is returned by the reconnect loop when the trigger is stopped
+var errStopped = errors.New("trigger stopped")
+
+// retry holds the reconnect policy and state of a connection: exponential
+// backoff with full jitter truncated to maxDelay, optionally endless, with a
+// cool-down before starting over once all attempts are exhausted
+type retry struct {
+	attempts         int64
+	initialDelay     time.Duration
+	maxDelay         time.Duration
+	maxReconAttempts int64
+	coolDown         time.Duration
+	resetAfter       time.Duration
+	connectedAt      time.Time
+	lastErr          error
+}
+
+func newRetry(s *Settings) *retry {
+	return &retry{
+		initialDelay:     time.Duration(s.AutoReconnectInitialDelay) * time.Second,
+		maxDelay:         time.Duration(s.AutoReconnectMaxDelay) * time.Second,
+		maxReconAttempts: int64(s.AutoReconnectAttempts),
+		coolDown:         time.Duration(s.AutoReconnectCoolDown) * time.Second,
+		resetAfter:       time.Duration(s.AutoReconnectResetAfter) * time.Second,
+	}
+}
+
+// endless reports whether the policy never gives up reconnecting
+func (r *retry) endless() bool {
+	return r.maxReconAttempts < 0 || (r.maxReconAttempts > 0 && r.coolDown > 0)
+}
+
+// backoff returns a random delay between zero and the exponentially growing
+// ceiling for the current attempt
+func (r *retry) backoff() time.Duration {
+	ceiling := r.maxDelay
+	if r.attempts < 32 {
+		if d := r.initialDelay << uint(r.attempts); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// connected records a successfully established connection
+func (r *retry) connected() {
+	r.connectedAt = time.Now()
+}
+
+// disconnected records the loss of the connection, the attempt counter is
+// reset when the connection was stable for the configured period
+func (r *retry) disconnected(err error) {
+	r.lastErr = err
+	if !r.connectedAt.IsZero() && time.Since(r.connectedAt) >= r.resetAfter {
+		r.attempts = 0
+	}
+	r.connectedAt = time.Time{}
+}
+
+func (r *retry) closeAndReconnect(c *connection) error {
+	c.close()
+	return r.retryConnection(c)
+}
+
+func (r *retry) retryConnection(c *connection) error {
+	t := c.t
+	if r.maxReconAttempts == 0 {
+		return fmt.Errorf("No retry attempt as AutoReconnectAttempts configured value is [%d]", r.maxReconAttempts)
+	}
+	for {
+		if r.maxReconAttempts > 0 && r.attempts >= r.maxReconAttempts {
+			err := fmt.Errorf("Exhausted all retry attempts [%d] with err: [%v]", r.attempts, r.lastErr)
+			if r.coolDown <= 0 {
+				return err
+			}
+			t.logger.Warnf("%s, retrying again after cool-down of %s", err, r.coolDown)
+			t.fireEvent(c, EventFailed, r.attempts, r.lastErr)
+			if !t.wait(r.coolDown) {
+				return errStopped
+			}
+			r.attempts = 0
+		}
+		if !t.wait(r.backoff()) {
+			return errStopped
+		}
+		r.attempts++
+		t.logger.Infof("Websocket Connection retry attempt [%d]", r.attempts)
+		t.fireEvent(c, EventReconnecting, r.attempts, r.lastErr)
+		if e := c.connect(); e != nil {
+			r.lastErr = e
+			continue
+		}
+		r.connected()
+		t.fireEvent(c, EventConnected, r.attempts, nil)
+		return nil
+	}
+}
+
+// wait sleeps for the supplied duration, it returns false when the trigger
+// got stopped in the meantime
+func (t *Trigger) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.done:
+		return false
+	}
+}
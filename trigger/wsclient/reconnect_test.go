@@ -0,0 +1,40 @@
+package wsclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	r := newRetry(&Settings{AutoReconnectInitialDelay: 1, AutoReconnectMaxDelay: 10, AutoReconnectAttempts: 5})
+	for attempts, ceiling := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		r.attempts = int64(attempts)
+		for i := 0; i < 100; i++ {
+			d := r.backoff()
+			assert.True(t, d >= 0 && d <= ceiling, "attempt %d: %s exceeds %s", attempts, d, ceiling)
+		}
+	}
+	r.attempts = 1000
+	assert.True(t, r.backoff() <= 10*time.Second)
+}
+
+func TestRetryReset(t *testing.T) {
+	r := newRetry(&Settings{AutoReconnectAttempts: 5, AutoReconnectResetAfter: 60})
+	r.attempts = 3
+	r.connected()
+	r.disconnected(nil)
+	assert.Equal(t, int64(3), r.attempts, "flapping connection must not reset attempts")
+
+	r.connectedAt = time.Now().Add(-time.Minute)
+	r.disconnected(nil)
+	assert.Equal(t, int64(0), r.attempts, "stable connection must reset attempts")
+}
+
+func TestRetryEndless(t *testing.T) {
+	assert.True(t, newRetry(&Settings{AutoReconnectAttempts: -1}).endless())
+	assert.True(t, newRetry(&Settings{AutoReconnectAttempts: 3, AutoReconnectCoolDown: 5}).endless())
+	assert.False(t, newRetry(&Settings{AutoReconnectAttempts: 3}).endless())
+	assert.False(t, newRetry(&Settings{AutoReconnectAttempts: 0, AutoReconnectCoolDown: 5}).endless())
+}
@@ -1,21 +1,14 @@
 package wsclient
 
 import (
-	"bytes"
-	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/project-flogo/core/data/metadata"
@@ -25,9 +18,13 @@ import (
 	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/support/log"
 	"github.com/project-flogo/core/trigger"
+	"github.com/project-flogo/websocket/internal/heartbeat"
+	"github.com/project-flogo/websocket/internal/oauth"
+	"github.com/project-flogo/websocket/internal/proxyconfig"
+	"github.com/project-flogo/websocket/internal/tlsconfig"
 )
 
-var triggerMd = trigger.NewMetadata(&Settings{}, &Output{})
+var triggerMd = trigger.NewMetadata(&Settings{}, &Output{}, &HandlerSettings{})
 
 func init() {
 	trigger.Register(&Trigger{}, &Factory{})
@@ -45,17 +42,29 @@ func (*Factory) Metadata() *trigger.Metadata {
 // Trigger trigger struct
 type Trigger struct {
 	runner       action.Runner
-	wsconn       *websocket.Conn
+	conns        []*connection
 	settings     *Settings
 	logger       log.Logger
 	config       *trigger.Config
 	tInitContext trigger.InitContext
-	continuePing bool
 	dialer       websocket.Dialer
-	urlstring    string
+	endpoints    *endpoints
 	header       http.Header
-	mu           sync.Mutex
-	pingdone     chan bool
+	onConnect    [][]byte
+	shards       [][]byte
+	tokens       *oauth.Source
+	heartbeat    *heartbeat.Heartbeat
+	handlers     []*clientHandler
+	dispatcher   *dispatcher
+	started      int32
+	done         chan struct{}
+}
+
+// clientHandler is a trigger handler along with the filter selecting its messages
+type clientHandler struct {
+	handler trigger.Handler
+	mode    string
+	filter  *messageFilter
 }
 
 // New implements trigger.Factory.New
@@ -71,13 +80,59 @@ func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
 	if _, ok := config.Settings["autoReconnectMaxDelay"]; !ok {
 		s.AutoReconnectMaxDelay = 30
 	}
-	return &Trigger{settings: s, config: config, continuePing: true}, nil
+	if _, ok := config.Settings["autoReconnectInitialDelay"]; !ok {
+		s.AutoReconnectInitialDelay = 1
+	}
+	if _, ok := config.Settings["autoReconnectResetAfter"]; !ok {
+		s.AutoReconnectResetAfter = 60
+	}
+	if _, ok := config.Settings["failbackInterval"]; !ok {
+		s.FailbackInterval = 30
+	}
+	if _, ok := config.Settings["failoverQuarantine"]; !ok || s.FailoverQuarantine < 1 {
+		s.FailoverQuarantine = 30
+	}
+	if s.Connections <= 0 {
+		s.Connections = 1
+	}
+	if _, ok := config.Settings["dispatchWorkers"]; !ok {
+		s.DispatchWorkers = 10
+	}
+	if _, ok := config.Settings["dispatchQueueSize"]; !ok {
+		s.DispatchQueueSize = 100
+	}
+	if _, ok := config.Settings["heartbeatInterval"]; !ok {
+		s.HeartbeatInterval = 30
+	}
+	if _, ok := config.Settings["heartbeatTimeout"]; !ok {
+		s.HeartbeatTimeout = 10
+	}
+	if _, ok := config.Settings["oauthRenewBefore"]; !ok {
+		s.OAuthRenewBefore = 60
+	}
+	if _, ok := config.Settings["onConnectAckTimeout"]; !ok {
+		s.OnConnectAckTimeout = 10
+	}
+	return &Trigger{settings: s, config: config, done: make(chan struct{})}, nil
 }
 
 func populateConnectionParams(t *Trigger) error {
 	headers := t.settings.Headers
 	queryParams := t.settings.QueryParams
-	urlstring := t.settings.URL
+	urls := []string{t.settings.URL}
+	failoverURLs, err := coerce.ToArray(t.settings.FailoverURLs)
+	if err != nil {
+		return fmt.Errorf("invalid failoverURLs - %s", err)
+	}
+	for _, u := range failoverURLs {
+		str, err := coerce.ToString(u)
+		if err != nil {
+			return fmt.Errorf("invalid failoverURLs entry [%v] - %s", u, err)
+		}
+		if str = strings.TrimSpace(str); str != "" {
+			urls = append(urls, str)
+		}
+	}
 	// populate headers
 	header := make(http.Header)
 	if len(headers) > 0 {
@@ -103,84 +158,145 @@ func populateConnectionParams(t *Trigger) error {
 				}
 			}
 		}
-		urlstring = urlstring + "?" + qp.Encode()
+		for i := range urls {
+			urls[i] = urls[i] + "?" + qp.Encode()
+		}
 	}
 	var isWSS bool
-	if urlstring != "" {
-		isWSS = strings.HasPrefix(urlstring, "wss")
+	for _, urlstring := range urls {
+		isWSS = isWSS || strings.HasPrefix(urlstring, "wss")
 	}
 	var dialer websocket.Dialer
 	if isWSS {
-		tlsconfig := &tls.Config{}
-		allowInsecure := t.settings.AllowInsecure
-		if allowInsecure {
-			tlsconfig.InsecureSkipVerify = true
-		} else {
-			caCertValue := t.settings.CaCert
-			var cacertObj map[string]interface{}
-			if caCertValue != "" {
-				err := json.Unmarshal([]byte(caCertValue), &cacertObj)
-				if err != nil { // filepath configured
-					certPool, err := getCerts(caCertValue)
-					if err != nil {
-						t.logger.Errorf("Error while loading client trust store - %v", err)
-						return err
-					}
-					tlsconfig.RootCAs = certPool
-				} else { // file content configured
-					rootCAbytes, err := decodeCerts(caCertValue, t.logger)
-					if err != nil {
-						t.logger.Errorf("Error while loading client trust store content - %v", err)
-						return err
-					}
-					certPool := x509.NewCertPool()
-					certsAdded := certPool.AppendCertsFromPEM(rootCAbytes)
-					if !certsAdded {
-						t.logger.Error("Unsupported certificate found. It must be a valid PEM certificate.")
-						return fmt.Errorf("Unsupported certificate found. It must be a valid PEM certificate.")
-					}
-					tlsconfig.RootCAs = certPool
-				}
-			}
+		tlsConf, err := tlsConfig(t.settings).ClientConfig(t.logger)
+		if err != nil {
+			t.logger.Error(err)
+			return err
 		}
-		dialer = websocket.Dialer{TLSClientConfig: tlsconfig,
+		dialer = websocket.Dialer{TLSClientConfig: tlsConf,
 			HandshakeTimeout: 45 * time.Second,
 		} // as defaultDialer
 	} else {
 		dialer = *websocket.DefaultDialer
 	}
+	dialer.Proxy, err = proxyConfig(t.settings).ProxyFunc()
+	if err != nil {
+		return err
+	}
+	for _, protocol := range strings.Split(t.settings.Subprotocols, ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			dialer.Subprotocols = append(dialer.Subprotocols, protocol)
+		}
+	}
+	if t.settings.CookieJar {
+		// cookies set by the handshake responses are sent on every reconnect
+		dialer.Jar, err = cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+	}
+	// populate subscription/handshake messages
+	messages, err := coerce.ToArray(t.settings.OnConnectMessages)
+	if err != nil {
+		return fmt.Errorf("invalid onConnectMessages - %s", err)
+	}
+	onConnect, err := toMessages(messages)
+	if err != nil {
+		return fmt.Errorf("invalid onConnectMessages entry - %s", err)
+	}
+	messages, err = coerce.ToArray(t.settings.ShardedMessages)
+	if err != nil {
+		return fmt.Errorf("invalid shardedMessages - %s", err)
+	}
+	shards, err := toMessages(messages)
+	if err != nil {
+		return fmt.Errorf("invalid shardedMessages entry - %s", err)
+	}
+	hb, err := heartbeat.New(t.settings.HeartbeatMessage, t.settings.HeartbeatResponse,
+		time.Duration(t.settings.HeartbeatInterval)*time.Second, time.Duration(t.settings.HeartbeatTimeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	tokens, err := oauth.NewSource(&oauth.Config{
+		TokenURL:     t.settings.OAuthTokenURL,
+		ClientID:     t.settings.OAuthClientID,
+		ClientSecret: t.settings.OAuthClientSecret,
+		Scopes:       t.settings.OAuthScopes,
+		AuthStyle:    t.settings.OAuthAuthStyle,
+		TokenIn:      t.settings.OAuthTokenIn,
+		TokenName:    t.settings.OAuthTokenName,
+		RenewBefore:  time.Duration(t.settings.OAuthRenewBefore) * time.Second,
+	}, &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: dialer.Proxy, TLSClientConfig: dialer.TLSClientConfig},
+	})
+	if err != nil {
+		return err
+	}
+	endpoints, err := newEndpoints(urls, t.settings.FailoverStrategy, time.Duration(t.settings.FailoverQuarantine)*time.Second)
+	if err != nil {
+		return err
+	}
 	t.dialer = dialer
-	t.urlstring = urlstring
+	t.endpoints = endpoints
 	t.header = header
+	t.onConnect = onConnect
+	t.shards = shards
+	t.heartbeat = hb
+	t.tokens = tokens
 	return nil
 }
 
-func connect(t *Trigger) error {
-	t.logger.Infof("[ %s ] dialing websocket endpoint [%s]...", t.config.Id, t.urlstring)
-	t.logger.Debugf("[ %s ] dialing websocket endpoint with headers [%s]...", t.config.Id, t.header)
-	conn, res, err := t.dialer.Dial(t.urlstring, t.header)
-	if err != nil {
-		if res != nil {
-			defer res.Body.Close()
-			body, err1 := ioutil.ReadAll(res.Body)
-			if err1 != nil {
-				t.logger.Errorf("response code is: %v , error while reading response payload is: %s ", res.StatusCode, err1)
-			}
-			t.logger.Errorf("response code is: %v , payload is: %s , error is: %s", res.StatusCode, string(body), err)
+// toMessages converts configured messages to their wire format, objects are sent as JSON
+func toMessages(messages []interface{}) ([][]byte, error) {
+	var result [][]byte
+	for _, message := range messages {
+		if str, ok := message.(string); ok {
+			result = append(result, []byte(str))
+			continue
 		}
-		return fmt.Errorf("error while connecting to websocket endpoint[%s] - %s", t.urlstring, err)
+		b, err := json.Marshal(message)
+		if err != nil {
+			return nil, fmt.Errorf("[%v] - %s", message, err)
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+func tlsConfig(s *Settings) *tlsconfig.Config {
+	return &tlsconfig.Config{
+		AllowInsecure: s.AllowInsecure,
+		CaCert:        s.CaCert,
+		Cert:          s.ClientCert,
+		Key:           s.ClientKey,
+		Password:      s.CertPassword,
+		MinVersion:    s.MinTLSVersion,
+		MaxVersion:    s.MaxTLSVersion,
+		CipherSuites:  s.CipherSuites,
 	}
-	t.mu.Lock()
-	t.wsconn = conn
-	t.mu.Unlock()
-	t.logger.Infof("websocket connection [%p] established successfully", t.wsconn)
-	return nil
 }
 
-type retry struct {
-	attempts         int64
-	maxDelay         time.Duration
-	maxReconAttempts int64
+// handshake returns the url and headers of a handshake request to the
+// endpoint, including the current access token
+func (t *Trigger) handshake(urlstring string) (string, http.Header, *oauth.Token, error) {
+	if t.tokens == nil {
+		return urlstring, t.header, nil, nil
+	}
+	dialURL, header, token, err := t.tokens.Apply(urlstring, t.header)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error while fetching access token for websocket endpoint[%s] - %s", urlstring, err)
+	}
+	return dialURL, header, token, nil
+}
+
+func proxyConfig(s *Settings) *proxyconfig.Config {
+	return &proxyconfig.Config{
+		URL:      s.ProxyURL,
+		User:     s.ProxyUser,
+		Password: s.ProxyPassword,
+		NoProxy:  s.NoProxy,
+	}
 }
 
 // Initialize initializes the trigger
@@ -190,21 +306,51 @@ func (t *Trigger) Initialize(ctx trigger.InitContext) error {
 	if err != nil {
 		return err
 	}
-	err1 := connect(t)
-	if err1 != nil {
-		re := &retry{
-			attempts:         0,
-			maxDelay:         time.Duration(t.settings.AutoReconnectMaxDelay) * time.Second,
-			maxReconAttempts: int64(t.settings.AutoReconnectAttempts),
+	t.tInitContext = ctx
+	t.dispatcher, err = newDispatcher(t, t.settings)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < t.settings.Connections; i++ {
+		c := newConnection(t, i)
+		t.conns = append(t.conns, c)
+		err1 := c.connect()
+		if err1 != nil {
+			c.retry.lastErr = err1
+			if c.retry.endless() {
+				// don't block the engine startup, the listener keeps reconnecting
+				t.logger.Warnf("%s, reconnecting in the background", err1)
+				continue
+			}
+			err2 := c.retry.closeAndReconnect(c)
+			if err2 != nil {
+				return err2
+			}
+		} else {
+			c.retry.connected()
 		}
-		err2 := re.closeAndReconnect(t)
-		if err2 != nil {
-			return err2
+		// set ponghanlder to print the received pong message from server
+		c.startPingSetPongHandler()
+	}
+	// Init handlers
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
 		}
+		filter, err := newMessageFilter(s)
+		if err != nil {
+			return fmt.Errorf("invalid settings for handler [%s] - %s", handler.Name(), err)
+		}
+		mode := ModeData
+		if strings.EqualFold(s.Mode, ModeEvents) {
+			mode = ModeEvents
+		} else if s.Mode != "" && !strings.EqualFold(s.Mode, ModeData) {
+			return fmt.Errorf("unsupported mode [%s] for handler [%s]", s.Mode, handler.Name())
+		}
+		t.handlers = append(t.handlers, &clientHandler{handler: handler, mode: mode, filter: filter})
 	}
-	// set ponghanlder to print the received pong message from server
-	startPingSetPongHandler(t)
-	t.tInitContext = ctx
 	return nil
 }
 
@@ -213,260 +359,107 @@ func isJSON(str []byte) bool {
 	return json.Unmarshal(str, &js) == nil
 }
 
-func (r *retry) closeAndReconnect(t *Trigger) error {
-	close(t)
-	e := r.retryConnection(t)
-	return e
-}
-
-func close(t *Trigger) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if t.wsconn != nil {
-		select {
-		case t.pingdone <- true:
-			t.logger.Debug("Sending pingdone signal to deactivate ping service for this connection")
-		default:
-			t.logger.Debug("No active ping service so signal not sent")
+// Start starts the trigger
+func (t *Trigger) Start() error {
+	for _, c := range t.conns {
+		if c.wsconn == nil && !c.retry.endless() {
+			t.logger.Error("Websocket Connection not initialized")
+			return errors.New("Websocket Connection not initialized")
 		}
-		t.wsconn.Close()
 	}
-}
-
-func (r *retry) retryConnection(t *Trigger) error {
-	if r.maxReconAttempts <= 0 {
-		return fmt.Errorf("No retry attempt as AutoReconnectAttempts configured value is [%d]", r.maxReconAttempts)
-	}
-	if r.attempts < r.maxReconAttempts {
-		// exponential backoff truncated to max delay
-		dur := time.Duration(r.attempts*2) * time.Second
-		if dur > r.maxDelay {
-			dur = r.maxDelay
-		}
-		time.Sleep(dur)
-		r.attempts++
-		t.logger.Infof("Websocket Connection retry attempt [%d]", r.attempts)
-		if e := connect(t); e != nil {
-			if r.attempts == r.maxReconAttempts {
-				return fmt.Errorf("Exhausted all retry attempts [%d] with err: [%s]", r.attempts, e.Error())
-			} else {
-				return r.retryConnection(t)
-			}
+	atomic.StoreInt32(&t.started, 1)
+	if t.dispatcher != nil {
+		t.dispatcher.start()
+	}
+	for _, c := range t.conns {
+		if c.wsconn != nil {
+			t.fireEvent(c, EventConnected, 0, nil)
 		}
+		go c.listen()
+	}
+	if t.settings.FailbackInterval > 0 {
+		go t.failback()
 	}
 	return nil
 }
 
-// Start starts the trigger
-func (t *Trigger) Start() error {
-	if t.wsconn != nil {
-		go func() {
-			defer func() {
-				if t.wsconn != nil {
-					text := []byte("Sending close message while getting out of reading connection loop")
-					message := websocket.FormatCloseMessage(websocket.CloseGoingAway, string(text))
-					err := t.wsconn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
-					if err != nil {
-						t.logger.Warnf("Received error [%s] while writing close message", err)
-					}
-					t.logger.Info("Closing connection while going out of trigger handler")
-					//t.wsconn.Close()
-					close(t)
-				}
-			}()
-			for {
-				_, message, err := t.wsconn.ReadMessage()
-				if err != nil {
-					t.logger.Errorf("error while reading websocket message: %s", err)
-					if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-						break
-					}
-					re := &retry{
-						attempts:         0,
-						maxDelay:         time.Duration(t.settings.AutoReconnectMaxDelay) * time.Second,
-						maxReconAttempts: int64(t.settings.AutoReconnectAttempts),
-					}
-					t.logger.Debug("going to retry for connection")
-					err2 := re.closeAndReconnect(t)
-					if err2 != nil {
-						t.logger.Errorf("Connection error after max retry : %s", err2)
-						break
-					} else {
-						startPingSetPongHandler(t)
-						continue
-					}
-				}
-				t.logger.Debug("New message received...")
-				out := &Output{}
-				var content interface{}
-				if (t.config.Settings["format"] != nil && t.config.Settings["format"].(string) == "JSON") ||
-					(t.config.Settings["format"] == nil && isJSON(message)) {
-					err := json.NewDecoder(bytes.NewBuffer(message)).Decode(&content)
-					if err != nil {
-						t.logger.Errorf("error while decoding websocket message of JSON type : %s", err)
-						break
-					}
-				} else {
-					content = string(message)
-				}
-				out.Content = content
-				out.WSconnection = t.wsconn
-				for _, handler := range t.tInitContext.GetHandlers() {
-					_, err1 := handler.Handle(context.Background(), out)
-					if err1 != nil {
-						t.logger.Errorf("Run action  failed [%s] ", err1)
-					}
-				}
+// failback periodically probes the primary endpoint while connections are
+// established to a secondary one and moves them back once the primary recovered
+func (t *Trigger) failback() {
+	ticker := time.NewTicker(time.Duration(t.settings.FailbackInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		}
+		var primary *endpoint
+		var failingBack []*connection
+		for _, c := range t.conns {
+			c.mu.Lock()
+			if p := t.endpoints.primary(c.endpoint); p != nil {
+				primary = p
+				failingBack = append(failingBack, c)
 			}
-			t.logger.Infof("stopped listening to websocket endpoint")
-		}()
-	} else {
-		t.logger.Error("Websocket Connection not initialized")
-		return errors.New("Websocket Connection not initialized")
+			c.mu.Unlock()
+		}
+		if primary == nil {
+			continue
+		}
+		urlstring, header, _, err := t.handshake(primary.url)
+		if err != nil {
+			t.logger.Warn(err)
+			continue
+		}
+		conn, _, err := t.dialer.Dial(urlstring, header)
+		if err != nil {
+			t.logger.Debugf("primary websocket endpoint [%s] not recovered yet - %s", primary.url, err)
+			continue
+		}
+		conn.Close()
+		t.logger.Infof("primary websocket endpoint [%s] recovered, failing back", primary.url)
+		t.endpoints.success(primary)
+		for _, c := range failingBack {
+			c.mu.Lock()
+			conn := c.wsconn
+			c.mu.Unlock()
+			c.closeWith(conn, true, fmt.Errorf("failing back to primary websocket endpoint [%s]", primary.url))
+		}
 	}
-	return nil
 }
 
-func startPingSetPongHandler(t *Trigger) {
-	if t.wsconn != nil {
-		t.wsconn.SetPongHandler(func(msg string) error {
-			t.tInitContext.Logger().Debugf("received pong msg from server: %s", msg)
-			return nil
-		})
-		// send ping to avoid TCI connection timeout
-		pingdone := make(chan bool)
-		go ping(t, pingdone)
-		t.pingdone = pingdone
+// stopped reports whether Stop was called
+func (t *Trigger) stopped() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
 	}
 }
 
 // Stop stops the trigger
 func (t *Trigger) Stop() error {
 	t.logger.Infof("Stopping Trigger %s", t.config.Id)
-	t.continuePing = false
-	text := []byte("Closing connection while stopping trigger")
-	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, string(text))
-	err := t.wsconn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
-	if err != nil {
-		t.logger.Warnf("Error received: [%s] while sending close message when Stopping Trigger", err)
-	}
-	close(t)
-	defer t.logger.Info("Trigger %s Stopped", t.config.Id)
-	return nil
-}
-
-func getCerts(trustStore string) (*x509.CertPool, error) {
-	certPool := x509.NewCertPool()
-	fileInfo, err := os.Stat(trustStore)
-	if err != nil {
-		return certPool, fmt.Errorf("Truststore [%s] does not exist", trustStore)
-	}
-	switch mode := fileInfo.Mode(); {
-	case mode.IsDir():
-		break
-	case mode.IsRegular():
-		return certPool, fmt.Errorf("Truststore [%s] is not a directory.  Must be a directory containing trusted certificates in PEM format",
-			trustStore)
-	}
-	trustedCertFiles, err := ioutil.ReadDir(trustStore)
-	if err != nil || len(trustedCertFiles) == 0 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  Must be a directory containing trusted certificates in PEM format", trustStore)
-	}
-	for _, trustCertFile := range trustedCertFiles {
-		fqfName := fmt.Sprintf("%s%c%s", trustStore, os.PathSeparator, trustCertFile.Name())
-		trustCertBytes, err := ioutil.ReadFile(fqfName)
-		if err != nil {
-			fmt.Errorf("Failed to read trusted certificate [%s] ... continueing", trustCertFile.Name())
-		}
-		certPool.AppendCertsFromPEM(trustCertBytes)
-	}
-	if len(certPool.Subjects()) < 1 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  After processing all files in the directory no valid trusted certs were found", trustStore)
-	}
-	return certPool, nil
-}
-
-func decodeCerts(certVal string, log log.Logger) ([]byte, error) {
-	if certVal == "" {
-		return nil, fmt.Errorf("Certificate is Empty")
-	}
-
-	//if certificate comes from fileselctor it will be base64 encoded
-	if strings.HasPrefix(certVal, "{") {
-		log.Info("Certificate received from FileSelector")
-		certObj, err := coerce.ToObject(certVal)
-		if err == nil {
-			certRealValue, ok := certObj["content"].(string)
-			log.Infof("Fetched Content from Certificate Object")
-			if !ok || certRealValue == "" {
-				return nil, fmt.Errorf("Did not found the certificate content")
-			}
-
-			index := strings.IndexAny(certRealValue, ",")
-			if index > -1 {
-				certRealValue = certRealValue[index+1:]
-			}
-
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, err
+	if !t.stopped() {
+		close(t.done)
 	}
-
-	//if the certificate comes from application properties need to check whether that it contains , ans encoding
-	index := strings.IndexAny(certVal, ",")
-
-	if index > -1 {
-		//some encoding is there
-		log.Debugf("Certificate received from App properties with encoding")
-		encoding := certVal[:index]
-		certRealValue := certVal[index+1:]
-
-		if strings.EqualFold(encoding, "base64") {
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, fmt.Errorf("Error in parsing the certificates Or we may be not be supporting the given encoding")
-	}
-
-	log.Debugf("Certificate received from App properties without encoding")
-
-	//===========These blocks of code to be removed after sriharsha fixes FLOGO-2673=================================
-	first := strings.TrimSpace(certVal[:strings.Index(certVal, "----- ")] + "-----")
-	middle := strings.TrimSpace(certVal[strings.Index(certVal, "----- ")+5 : strings.Index(certVal, " -----")])
-	strings.Replace(middle, " ", "\n", -1)
-	last := strings.TrimSpace(certVal[strings.Index(certVal, " -----"):])
-	certVal = first + "\n" + middle + "\n" + last
-	//===========These blocks of code to be removed after sriharsha fixes FLOGO-2673=================================
-
-	return []byte(certVal), nil
-}
-
-func ping(tr *Trigger, done chan bool) {
-	tr.logger.Debugf("starting ping ticker for conn: %p ", tr.wsconn)
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-	for {
-		if tr.continuePing {
-			select {
-			case t := <-ticker.C:
-				tr.logger.Debugf("Sending Ping at timestamp : %v", t)
-				if err := tr.wsconn.WriteControl(websocket.PingMessage, []byte("---HeartBeat---"), time.Now().Add(time.Second)); err != nil {
-					tr.logger.Errorf("error while sending ping: %v", err)
-					var ErrCloseSent = errors.New("websocket: close sent")
-					if err != ErrCloseSent {
-						e, ok := err.(net.Error)
-						if !ok || !e.Temporary() {
-							tr.logger.Debugf("stopping ping ticker for conn: %p as received non temporary error while sending ping: %s ", tr.wsconn, err.Error())
-							return
-						}
-					}
-				}
-			case <-done:
-				tr.logger.Debugf("stopping ping ticker for conn: %p as seems connection being releaved", tr.wsconn)
-				return
+	for _, c := range t.conns {
+		// a reconnect may be replacing the connection
+		c.mu.Lock()
+		conn := c.wsconn
+		c.mu.Unlock()
+		if conn != nil {
+			text := []byte("Closing connection while stopping trigger")
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, string(text))
+			err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+			if err != nil {
+				t.logger.Warnf("Error received: [%s] while sending close message when Stopping Trigger", err)
 			}
-		} else {
-			tr.logger.Debugf("stopping ping ticker for conn: %p while engine getting stopped", tr.wsconn)
-			return
 		}
+		c.close()
 	}
+	defer t.logger.Info("Trigger %s Stopped", t.config.Id)
+	return nil
 }
@@ -0,0 +1,91 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsServer returns the url of a websocket server handling every accepted
+// connection with handle
+func wsServer(t *testing.T, handle func(conn *websocket.Conn)) string {
+	up := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		handle(c)
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// testHandler records the outputs dispatched to a handler
+type testHandler struct {
+	mode    string
+	outputs chan *Output
+}
+
+func newTestHandler(mode string) *testHandler {
+	return &testHandler{mode: mode, outputs: make(chan *Output, 100)}
+}
+
+func (h *testHandler) Name() string {
+	return h.mode
+}
+
+func (h *testHandler) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (h *testHandler) Settings() map[string]interface{} {
+	return map[string]interface{}{"mode": h.mode}
+}
+
+func (h *testHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *testHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	h.outputs <- triggerData.(*Output)
+	return nil, nil
+}
+
+type initContext struct {
+	handlers []trigger.Handler
+}
+
+func (ctx *initContext) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (ctx *initContext) GetHandlers() []trigger.Handler {
+	return ctx.handlers
+}
+
+// startTrigger creates, initializes and starts the trigger with the supplied
+// settings and handlers, it is stopped at the end of the test
+func startTrigger(t *testing.T, settings map[string]interface{}, handlers ...trigger.Handler) *Trigger {
+	f := &Factory{}
+	trg, err := f.New(&trigger.Config{Id: t.Name(), Settings: settings})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	if !assert.Nil(t, trg.Initialize(&initContext{handlers: handlers})) {
+		t.FailNow()
+	}
+	if !assert.Nil(t, trg.Start()) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { trg.Stop() })
+	return trg.(*Trigger)
+}
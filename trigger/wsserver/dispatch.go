@@ -0,0 +1,206 @@
+package wsserver
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/trigger"
+	"github.com/project-flogo/websocket/internal/jsonpath"
+)
+
+const (
+	// DispatchSerial handles every message inside the read loop of the connection
+	DispatchSerial = "Serial"
+	// DispatchConcurrent hands the messages over to a pool of workers
+	DispatchConcurrent = "Concurrent"
+)
+
+const (
+	// ScopeConnection gives every connection its own pool of workers
+	ScopeConnection = "Connection"
+	// ScopeHandler shares a pool of workers between all connections of the handler
+	ScopeHandler = "Handler"
+)
+
+const (
+	// OrderNone handles messages in any order
+	OrderNone = "None"
+	// OrderStrict handles the messages of a connection in the order they were received
+	OrderStrict = "Strict"
+	// OrderKeyed handles messages with the same order key in the order they were received
+	OrderKeyed = "Keyed"
+)
+
+// job is a decoded message waiting for a worker, pending tracks the
+// unfinished jobs of the connection
+type job struct {
+	handler trigger.Handler
+	out     *Output
+	conn    *websocket.Conn
+	pending *sync.WaitGroup
+}
+
+// pool dispatches messages to a bounded set of workers. Without ordering all
+// workers share a single queue, otherwise every worker owns a queue and the
+// messages of a connection or with the same key always go to the same worker.
+// At most maxInFlight messages are queued or running, reading blocks beyond that
+type pool struct {
+	rt       *Trigger
+	queues   []chan *job
+	workers  int
+	order    string
+	key      jsonpath.Path
+	inFlight chan struct{}
+	next     uint32
+	done     chan struct{}
+}
+
+// dispatchSettings validates the dispatch settings of a handler
+func dispatchSettings(s *HandlerSettings) error {
+	switch {
+	case s.Dispatch == "" || strings.EqualFold(s.Dispatch, DispatchSerial):
+		s.Dispatch = DispatchSerial
+		return nil
+	case strings.EqualFold(s.Dispatch, DispatchConcurrent):
+		s.Dispatch = DispatchConcurrent
+	default:
+		return fmt.Errorf("unsupported dispatch [%s]", s.Dispatch)
+	}
+	switch {
+	case s.DispatchScope == "" || strings.EqualFold(s.DispatchScope, ScopeConnection):
+		s.DispatchScope = ScopeConnection
+	case strings.EqualFold(s.DispatchScope, ScopeHandler):
+		s.DispatchScope = ScopeHandler
+	default:
+		return fmt.Errorf("unsupported dispatchScope [%s]", s.DispatchScope)
+	}
+	switch {
+	case s.DispatchOrder == "" || strings.EqualFold(s.DispatchOrder, OrderNone):
+		s.DispatchOrder = OrderNone
+	case strings.EqualFold(s.DispatchOrder, OrderStrict):
+		s.DispatchOrder = OrderStrict
+	case strings.EqualFold(s.DispatchOrder, OrderKeyed):
+		s.DispatchOrder = OrderKeyed
+		if s.DispatchOrderKey == "" {
+			return fmt.Errorf("dispatchOrderKey is required for Keyed dispatchOrder")
+		}
+	default:
+		return fmt.Errorf("unsupported dispatchOrder [%s]", s.DispatchOrder)
+	}
+	if s.DispatchWorkers <= 0 {
+		return fmt.Errorf("dispatchWorkers must be greater than 0")
+	}
+	if s.MaxInFlight <= 0 {
+		return fmt.Errorf("maxInFlight must be greater than 0")
+	}
+	return nil
+}
+
+// newPool creates the pool for validated dispatch settings
+func newPool(rt *Trigger, s *HandlerSettings) (*pool, error) {
+	p := &pool{rt: rt, workers: s.DispatchWorkers, order: s.DispatchOrder, inFlight: make(chan struct{}, s.MaxInFlight), done: rt.done}
+	if p.order == OrderStrict && s.DispatchScope == ScopeConnection {
+		// a single connection in order needs a single worker
+		p.workers = 1
+	}
+	if p.order == OrderKeyed {
+		key, err := jsonpath.Compile(s.DispatchOrderKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dispatchOrderKey - %s", err)
+		}
+		p.key = key
+	}
+	queues := 1
+	if p.order != OrderNone {
+		queues = p.workers
+	}
+	for i := 0; i < queues; i++ {
+		p.queues = append(p.queues, make(chan *job, s.MaxInFlight))
+	}
+	return p, nil
+}
+
+// start launches the workers, they run until the pool is closed or the trigger is stopped
+func (p *pool) start() {
+	for i := 0; i < p.workers; i++ {
+		go p.work(p.queues[i%len(p.queues)])
+	}
+}
+
+// close lets the workers finish the queued messages and exit, nothing must be
+// dispatched afterwards
+func (p *pool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+func (p *pool) work(queue chan *job) {
+	for {
+		select {
+		case j, ok := <-queue:
+			if !ok {
+				return
+			}
+			_, err := j.handler.Handle(context.Background(), j.out)
+			if err != nil {
+				p.rt.logger.Errorf("Error while processing message : Run action  failed [%s] ", err)
+			}
+			j.pending.Done()
+			<-p.inFlight
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// queue returns the queue of the job
+func (p *pool) queue(j *job) chan *job {
+	if len(p.queues) == 1 {
+		return p.queues[0]
+	}
+	h := fnv.New32a()
+	switch p.order {
+	case OrderStrict:
+		h.Write([]byte(fmt.Sprintf("%p", j.conn)))
+	case OrderKeyed:
+		value, ok := p.key.Get(j.out.Content)
+		if !ok {
+			return p.queues[atomic.AddUint32(&p.next, 1)%uint32(len(p.queues))]
+		}
+		h.Write([]byte(fmt.Sprint(value)))
+	}
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// dispatch enqueues the job, it blocks while maxInFlight messages are pending
+// which pauses reading from the connection
+func (p *pool) dispatch(j *job) {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-p.done:
+		return
+	}
+	j.pending.Add(1)
+	p.queue(j) <- j
+}
+
+// drain waits until the dispatched messages of a connection are handled, the
+// flows may still write to the connection until then. Queued messages are
+// abandoned when the trigger is stopped
+func (p *pool) drain(pending *sync.WaitGroup) {
+	drained := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-p.done:
+	}
+}
@@ -0,0 +1,115 @@
+package wsserver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchSettings(t *testing.T) {
+	s := &HandlerSettings{}
+	assert.Nil(t, dispatchSettings(s))
+	assert.Equal(t, DispatchSerial, s.Dispatch)
+
+	s = &HandlerSettings{Dispatch: "concurrent", DispatchWorkers: 4, MaxInFlight: 10}
+	assert.Nil(t, dispatchSettings(s))
+	assert.Equal(t, ScopeConnection, s.DispatchScope)
+	assert.Equal(t, OrderNone, s.DispatchOrder)
+
+	assert.NotNil(t, dispatchSettings(&HandlerSettings{Dispatch: "Parallel", DispatchWorkers: 4, MaxInFlight: 10}))
+	assert.NotNil(t, dispatchSettings(&HandlerSettings{Dispatch: DispatchConcurrent, DispatchOrder: OrderKeyed, DispatchWorkers: 4, MaxInFlight: 10}))
+	assert.NotNil(t, dispatchSettings(&HandlerSettings{Dispatch: DispatchConcurrent, DispatchWorkers: 4}))
+}
+
+func TestPoolQueue(t *testing.T) {
+	rt := &Trigger{done: make(chan struct{})}
+	s := &HandlerSettings{Dispatch: DispatchConcurrent, DispatchScope: ScopeHandler, DispatchOrder: OrderStrict, DispatchWorkers: 4, MaxInFlight: 10}
+	p, err := newPool(rt, s)
+	assert.Nil(t, err)
+	assert.Len(t, p.queues, 4)
+	conn := &websocket.Conn{}
+	assert.Equal(t, p.queue(&job{conn: conn, out: &Output{}}), p.queue(&job{conn: conn, out: &Output{}}))
+
+	s.DispatchScope = ScopeConnection
+	p, err = newPool(rt, s)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, p.workers, "a connection in strict order needs a single worker")
+
+	s.DispatchOrder, s.DispatchOrderKey = OrderKeyed, "$.symbol"
+	p, err = newPool(rt, s)
+	assert.Nil(t, err)
+	keyed := func(symbol string) *job {
+		return &job{out: &Output{Content: map[string]interface{}{"symbol": symbol}}}
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, p.queue(keyed("ABC")), p.queue(keyed("ABC")))
+	}
+}
+
+// slowHandler counts the handled messages after a delay
+type slowHandler struct {
+	handled int32
+}
+
+func (h *slowHandler) Name() string {
+	return "slow"
+}
+
+func (h *slowHandler) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (h *slowHandler) Settings() map[string]interface{} {
+	return nil
+}
+
+func (h *slowHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *slowHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	time.Sleep(50 * time.Millisecond)
+	atomic.AddInt32(&h.handled, 1)
+	return nil, nil
+}
+
+func TestPoolDrain(t *testing.T) {
+	rt := &Trigger{logger: log.RootLogger(), done: make(chan struct{})}
+	p, err := newPool(rt, &HandlerSettings{Dispatch: DispatchConcurrent, DispatchOrder: OrderNone, DispatchWorkers: 2, MaxInFlight: 10})
+	assert.Nil(t, err)
+	p.start()
+	h := &slowHandler{}
+	var pending sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		p.dispatch(&job{handler: h, out: &Output{}, pending: &pending})
+	}
+	p.drain(&pending)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&h.handled), "drain returns once the dispatched messages are handled")
+	p.close()
+
+	// queued messages are abandoned on stop
+	p, err = newPool(rt, &HandlerSettings{Dispatch: DispatchConcurrent, DispatchOrder: OrderNone, DispatchWorkers: 1, MaxInFlight: 10})
+	assert.Nil(t, err)
+	p.start()
+	for i := 0; i < 6; i++ {
+		p.dispatch(&job{handler: &slowHandler{}, out: &Output{}, pending: &pending})
+	}
+	close(rt.done)
+	drained := make(chan struct{})
+	go func() {
+		p.drain(&pending)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("drain blocked after stop")
+	}
+}
@@ -4,12 +4,17 @@ import "github.com/project-flogo/core/data/coerce"
 
 // Settings are the settings for the websocket server
 type Settings struct {
-	Port              int    `md:"port,required"`
-	EnabledTLS        bool   `md:"enableTLS"`
-	ServerCert        string `md:"serverCert"`
-	ServerKey         string `md:"serverKey"`
-	ClientAuthEnabled bool   `md:"enableClientAuth"`
-	TrustStore        string `md:"trustStore"`
+	Port               int    `md:"port,required"`
+	EnabledTLS         bool   `md:"enableTLS"`
+	ServerCert         string `md:"serverCert"`
+	ServerKey          string `md:"serverKey"`
+	CertPassword       string `md:"certPassword"`
+	ClientAuthEnabled  bool   `md:"enableClientAuth"`
+	TrustStore         string `md:"trustStore"`
+	MinTLSVersion      string `md:"minTLSVersion"`
+	MaxTLSVersion      string `md:"maxTLSVersion"`
+	CipherSuites       string `md:"cipherSuites"`
+	CertReloadInterval int    `md:"certReloadInterval"`
 }
 
 // Output are the outputs of the websocket server
@@ -53,7 +58,13 @@ func (o *Output) FromMap(values map[string]interface{}) (err error) {
 
 // HandlerSettings are the settings for a handler
 type HandlerSettings struct {
-	Method string `md:"method,required,allowed(GET,POST,PUT,PATCH,DELETE)"`
-	Path   string `md:"path,required"`
-	Mode   string `md:"mode,required"`
+	Method           string `md:"method,required,allowed(GET,POST,PUT,PATCH,DELETE)"`
+	Path             string `md:"path,required"`
+	Mode             string `md:"mode,required"`
+	Dispatch         string `md:"dispatch"`
+	DispatchScope    string `md:"dispatchScope"`
+	DispatchWorkers  int    `md:"dispatchWorkers"`
+	DispatchOrder    string `md:"dispatchOrder"`
+	DispatchOrderKey string `md:"dispatchOrderKey"`
+	MaxInFlight      int    `md:"maxInFlight"`
 }
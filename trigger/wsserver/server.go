@@ -3,11 +3,8 @@ package wsserver
 import (
 	"crypto/md5"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -15,22 +12,19 @@ import (
 	"sync"
 	"time"
 
-	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/websocket/internal/tlsconfig"
 )
 
 // Graceful shutdown HttpServer from: https://github.com/corneldamian/httpway/blob/master/server.go
 
 // NewServer create a new server instance
 //param server - is a instance of http.Server, can be nil and a default one will be created
-func NewServer(addr string, handler http.Handler, enableTLS bool, serverCert string, serverKey string, enableClientAuth bool, trustStore string, tlogger log.Logger) *Server {
+//param tlsConfig - TLS settings of the server, nil when TLS is not enabled
+func NewServer(addr string, handler http.Handler, tlsConfig *tlsconfig.Config, tlogger log.Logger) *Server {
 	srv := &Server{}
 	srv.Server = &http.Server{Addr: addr, Handler: handler}
-	srv.enableTLS = enableTLS
-	srv.serverCert = serverCert
-	srv.serverKey = serverKey
-	srv.enableClientAuth = enableClientAuth
-	srv.trustStore = trustStore
+	srv.tlsConfig = tlsConfig
 	srv.logger = tlogger
 	return srv
 }
@@ -44,11 +38,7 @@ type Server struct {
 	lastError        error
 	serverGroup      *sync.WaitGroup
 	clientsGroup     chan bool
-	enableTLS        bool
-	serverCert       string
-	serverKey        string
-	enableClientAuth bool
-	trustStore       string
+	tlsConfig        *tlsconfig.Config
 	logger           log.Logger
 }
 
@@ -76,49 +66,13 @@ func (s *Server) Start() error {
 	hostname, _ := os.Hostname()
 	s.serverInstanceID = fmt.Sprintf("%x", md5.Sum([]byte(hostname+addr)))
 
-	if s.enableTLS {
-		//TLS is enabled, load server certificate & key files
+	if s.tlsConfig != nil {
+		//TLS is enabled, load server certificate & key
 		s.logger.Info("Reading certificates")
-		var cer tls.Certificate
-		if (strings.HasPrefix(s.serverKey, "{") || isBase64Encoded(s.serverKey)) &&
-			(strings.HasPrefix(s.serverCert, "{") || isBase64Encoded(s.serverCert)) {
-			// certfile uploaded in FE via filepicker, or keys configured via app property in base64 encoded, or raw form
-			privateKey, err := decodeCerts(s.serverKey, s.logger)
-			if err != nil {
-				return err
-			}
-			caCertificate, err := decodeCerts(s.serverCert, s.logger)
-			if err != nil {
-				return err
-			}
-			cer, err = tls.X509KeyPair(caCertificate, privateKey)
-			if err != nil {
-				fmt.Printf("Error while loading certificates - %v", err)
-				return err
-			}
-		} else {
-			// configured cert file path in OSS way
-			var err error
-			cer, err = tls.LoadX509KeyPair(s.serverCert, s.serverKey)
-			if err != nil {
-				fmt.Printf("Error while loading certificates - %v", err)
-				return err
-			}
-		}
-		var config *tls.Config
-		if s.enableClientAuth {
-			caCertPool, err := getCerts(s.trustStore)
-			if err != nil {
-				fmt.Printf("Error while loading client trust store - %v", err)
-				return err
-			}
-
-			config = &tls.Config{Certificates: []tls.Certificate{cer},
-				ClientAuth: tls.RequireAndVerifyClientCert,
-				ClientCAs:  caCertPool}
-			config.BuildNameToCertificate()
-		} else {
-			config = &tls.Config{Certificates: []tls.Certificate{cer}}
+		config, err := s.tlsConfig.ServerConfig(s.logger)
+		if err != nil {
+			s.logger.Errorf("Error while loading certificates - %v", err)
+			return err
 		}
 
 		// bind secure listener
@@ -224,97 +178,3 @@ func (sh *serverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	sh.handler.ServeHTTP(w, r)
 }
-
-func getCerts(trustStore string) (*x509.CertPool, error) {
-	certPool := x509.NewCertPool()
-	fileInfo, err := os.Stat(trustStore)
-	if err != nil {
-		return certPool, fmt.Errorf("Truststore [%s] does not exist", trustStore)
-	}
-	switch mode := fileInfo.Mode(); {
-	case mode.IsDir():
-		break
-	case mode.IsRegular():
-		return certPool, fmt.Errorf("Truststore [%s] is not a directory.  Must be a directory containing trusted certificates in PEM format",
-			trustStore)
-	}
-	trustedCertFiles, err := ioutil.ReadDir(trustStore)
-	if err != nil || len(trustedCertFiles) == 0 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  Must be a directory containing trusted certificates in PEM format", trustStore)
-	}
-	for _, trustCertFile := range trustedCertFiles {
-		fqfName := fmt.Sprintf("%s%c%s", trustStore, os.PathSeparator, trustCertFile.Name())
-		trustCertBytes, err := ioutil.ReadFile(fqfName)
-		if err != nil {
-			fmt.Errorf("Failed to read trusted certificate [%s] ... continueing", trustCertFile.Name())
-		}
-		certPool.AppendCertsFromPEM(trustCertBytes)
-	}
-	if len(certPool.Subjects()) < 1 {
-		return certPool, fmt.Errorf("Failed to read trusted certificates from [%s]  After processing all files in the directory no valid trusted certs were found", trustStore)
-	}
-	return certPool, nil
-}
-
-func decodeCerts(certVal string, tlogger log.Logger) ([]byte, error) {
-	if certVal == "" {
-		return nil, fmt.Errorf("Certificate is Empty")
-	}
-
-	//if certificate comes from fileselctor it will be base64 encoded
-	if strings.HasPrefix(certVal, "{") {
-		tlogger.Info("Certificate received from FileSelector")
-		certObj, err := coerce.ToObject(certVal)
-		if err == nil {
-			certRealValue, ok := certObj["content"].(string)
-			tlogger.Info("Fetched Content from Certificate Object")
-			if !ok || certRealValue == "" {
-				return nil, fmt.Errorf("Did not found the certificate content")
-			}
-
-			index := strings.IndexAny(certRealValue, ",")
-			if index > -1 {
-				certRealValue = certRealValue[index+1:]
-			}
-
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, err
-	}
-
-	//if the certificate comes from application properties need to check whether that it contains , ans encoding
-	return base64.StdEncoding.DecodeString(certVal)
-	/*index := strings.IndexAny(certVal, ",")
-
-	if index > -1 {
-		//some encoding is there
-		tlogger.Debug("Certificate received from App properties with encoding")
-		encoding := certVal[:index]
-		certRealValue := certVal[index+1:]
-
-		if strings.EqualFold(encoding, "base64") {
-			return base64.StdEncoding.DecodeString(certRealValue)
-		}
-		return nil, fmt.Errorf("Error in parsing the certificates Or we may be not be supporting the given encoding")
-	}
-
-	tlogger.Debug("Certificate received from App properties without encoding")
-
-	//===========These blocks of code to be removed after sriharsha fixes FLOGO-2673=================================
-	first := strings.TrimSpace(certVal[:strings.Index(certVal, "----- ")] + "-----")
-	middle := strings.TrimSpace(certVal[strings.Index(certVal, "----- ")+5 : strings.Index(certVal, " -----")])
-	strings.Replace(middle, " ", "\n", -1)
-	last := strings.TrimSpace(certVal[strings.Index(certVal, " -----"):])
-	certVal = first + "\n" + middle + "\n" + last
-	//===========These blocks of code to be removed after sriharsha fixes FLOGO-2673=================================
-
-	return []byte(certVal), nil */
-}
-
-func isBase64Encoded(certValue string) bool {
-	_, err := base64.StdEncoding.DecodeString(certValue)
-	if err != nil {
-		return false
-	}
-	return true
-}
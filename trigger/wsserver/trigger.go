@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,6 +21,8 @@ import (
 	"github.com/project-flogo/core/data/metadata"
 	"github.com/project-flogo/core/support/log"
 	"github.com/project-flogo/core/trigger"
+	"github.com/project-flogo/websocket/internal/tlsconfig"
+	"github.com/project-flogo/websocket/wslock"
 )
 
 var triggerMd = trigger.NewMetadata(&Settings{}, &Output{}, &HandlerSettings{})
@@ -53,11 +56,14 @@ type Trigger struct {
 	logger       log.Logger
 	continuePing bool
 	config       *trigger.Config
+	done         chan struct{}
 }
 
 type HandlerWrapper struct {
 	handler      trigger.Handler
 	wsconnection map[*websocket.Conn]string
+	settings     *HandlerSettings
+	pool         *pool
 }
 
 // New implements trigger.Factory.New
@@ -67,7 +73,10 @@ func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Trigger{settings: s, config: config}, nil
+	if _, ok := config.Settings["certReloadInterval"]; !ok {
+		s.CertReloadInterval = 60
+	}
+	return &Trigger{settings: s, config: config, done: make(chan struct{})}, nil
 }
 
 // Initialize initializes triggers
@@ -80,36 +89,29 @@ func (t *Trigger) Initialize(ctx trigger.InitContext) error {
 		panic(fmt.Sprintf("No Settings found for trigger"))
 	}
 	//Check whether TLS (Transport Layer Security) is enabled for the trigger
-	enableTLS := false
-	serverCert := ""
-	serverKey := ""
-	if t.settings.EnabledTLS != false {
-		enableTLSSetting := t.settings.EnabledTLS
-		if enableTLSSetting {
-			//TLS is enabled, get server certificate & key
-			enableTLS = true
-			if t.settings.ServerCert == "" {
-				panic(fmt.Sprintf("No serverCert found for trigger in settings"))
-			}
-			serverCert = t.settings.ServerCert
-
-			if t.settings.ServerKey == "" {
-				panic(fmt.Sprintf("No serverKey found for trigger in settings"))
-			}
-			serverKey = t.settings.ServerKey
+	var tlsConf *tlsconfig.Config
+	if t.settings.EnabledTLS {
+		//TLS is enabled, get server certificate & key
+		if t.settings.ServerCert == "" {
+			panic(fmt.Sprintf("No serverCert found for trigger in settings"))
 		}
-	}
-	//Check whether client auth is enabled
-	enableClientAuth := false
-	trustStore := ""
-	if t.settings.ClientAuthEnabled != false {
-		enableClientAuthSetting := t.settings.ClientAuthEnabled
-		if enableClientAuthSetting {
-			enableClientAuth = true
+		//serverKey may be omitted when serverCert is a PEM bundle or PKCS#12 archive
+		tlsConf = &tlsconfig.Config{
+			Cert:           t.settings.ServerCert,
+			Key:            t.settings.ServerKey,
+			Password:       t.settings.CertPassword,
+			MinVersion:     t.settings.MinTLSVersion,
+			MaxVersion:     t.settings.MaxTLSVersion,
+			CipherSuites:   t.settings.CipherSuites,
+			ReloadInterval: time.Duration(t.settings.CertReloadInterval) * time.Second,
+		}
+		//Check whether client auth is enabled
+		if t.settings.ClientAuthEnabled {
 			if t.settings.TrustStore == "" {
 				panic(fmt.Sprintf("Client auth is enabled but client trust store is not provided for trigger in settings"))
 			}
-			trustStore = t.settings.TrustStore
+			tlsConf.ClientAuth = true
+			tlsConf.CaCert = t.settings.TrustStore
 		}
 	}
 
@@ -120,24 +122,53 @@ func (t *Trigger) Initialize(ctx trigger.InitContext) error {
 		if err != nil {
 			return err
 		}
+		if _, ok := handler.Settings()["dispatchWorkers"]; !ok {
+			s.DispatchWorkers = 10
+		}
+		if _, ok := handler.Settings()["maxInFlight"]; !ok {
+			s.MaxInFlight = 100
+		}
+		err = dispatchSettings(s)
+		if err != nil {
+			return fmt.Errorf("invalid settings for handler [%s] - %s", handler.Name(), err)
+		}
 
 		method := s.Method
 		path := s.Path
 		mode := s.Mode
-		tHandler := &HandlerWrapper{handler: handler, wsconnection: map[*websocket.Conn]string{}}
+		tHandler := &HandlerWrapper{handler: handler, wsconnection: map[*websocket.Conn]string{}, settings: s}
+		if s.Dispatch == DispatchConcurrent && s.DispatchScope == ScopeHandler {
+			// validates the settings, the pool is created again on every start
+			_, err = newPool(t, s)
+			if err != nil {
+				return fmt.Errorf("invalid settings for handler [%s] - %s", handler.Name(), err)
+			}
+		}
 		t.handlers = append(t.handlers, tHandler)
 		t.logger.Infof("%s: Registered handler [Method: %s, Path: %s, Mode: %s]", t.config.Id, method, path, mode)
 		router.Handle(method, replacePath(path), newActionHandler(t, tHandler, mode))
 	}
 
 	t.logger.Infof("%s: Configured on port %d", t.config.Id, t.settings.Port)
-	t.server = NewServer(addr, router, enableTLS, serverCert, serverKey, enableClientAuth, trustStore, t.logger)
+	t.server = NewServer(addr, router, tlsConf, t.logger)
 
 	return nil
 }
 
 // Start starts the trigger
 func (t *Trigger) Start() error {
+	// closed by the previous stop
+	t.done = make(chan struct{})
+	for _, handler := range t.handlers {
+		if handler.settings.Dispatch == DispatchConcurrent && handler.settings.DispatchScope == ScopeHandler {
+			pool, err := newPool(t, handler.settings)
+			if err != nil {
+				return err
+			}
+			pool.start()
+			handler.pool = pool
+		}
+	}
 	return t.server.Start()
 }
 
@@ -145,10 +176,16 @@ func (t *Trigger) Start() error {
 func (t *Trigger) Stop() error {
 	t.logger.Infof("Stopping Trigger %s", t.config.Id)
 	t.continuePing = false
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
 	for _, handler := range t.handlers {
 		if handler.wsconnection != nil {
 			for conn, _ := range handler.wsconnection {
 				conn.Close()
+				wslock.Release(conn)
 			}
 		}
 	}
@@ -266,17 +303,33 @@ func newActionHandler(rt *Trigger, handlerwrapper *HandlerWrapper, mode string)
 			}
 			rt.logger.Info("Closing connection while going out of trigger handler")
 			conn.Close()
+			wslock.Release(conn)
 		}()
 		out.WSconnection = conn
 		switch mode {
 		case ModeMessage:
+			pool := handlerwrapper.pool
+			if handlerwrapper.settings.Dispatch == DispatchConcurrent && pool == nil {
+				pool, err = newPool(rt, handlerwrapper.settings)
+				if err != nil {
+					rt.logger.Errorf("Unable to create dispatch pool: %s", err)
+					return
+				}
+				pool.start()
+			}
+			var pending sync.WaitGroup
 			for {
 				_, message, err := conn.ReadMessage()
 				if err != nil {
 					rt.logger.Errorf("error while reading websocket message: %s", err)
 					break
 				}
-				err1 := handlerRoutine(message, handlerwrapper.handler, out)
+				var err1 error
+				if pool != nil {
+					err1 = dispatchRoutine(message, handlerwrapper.handler, out, pool, &pending)
+				} else {
+					err1 = handlerRoutine(message, handlerwrapper.handler, out)
+				}
 				if err1 != nil {
 					if strings.HasPrefix(err1.Error(), "JSON Message decoding Failed") {
 						rt.logger.Errorf("Received message is not in JSON format : ", err1)
@@ -289,6 +342,13 @@ func newActionHandler(rt *Trigger, handlerwrapper *HandlerWrapper, mode string)
 					rt.logger.Errorf("Error while processing message : ", err1.Error())
 				}
 			}
+			if pool != nil {
+				// the flows may still write to the connection
+				pool.drain(&pending)
+				if pool != handlerwrapper.pool {
+					pool.close()
+				}
+			}
 			rt.logger.Infof("Getting out of listening websocket connection in Data Mode")
 		case ModeConnection:
 			_, err := handlerwrapper.handler.Handle(context.Background(), out)
@@ -301,23 +361,44 @@ func newActionHandler(rt *Trigger, handlerwrapper *HandlerWrapper, mode string)
 }
 
 func handlerRoutine(message []byte, handler trigger.Handler, out *Output) error {
+	content, err := decodeMessage(message, handler)
+	if err != nil {
+		return err
+	}
+	out.Content = content
+	_, err = handler.Handle(context.Background(), out)
+	if err != nil {
+		return fmt.Errorf("Run action  failed [%s] ", err)
+	}
+	return nil
+}
+
+// dispatchRoutine decodes the message in the read loop and hands it over to
+// the pool with its own copy of the output
+func dispatchRoutine(message []byte, handler trigger.Handler, out *Output, pool *pool, pending *sync.WaitGroup) error {
+	content, err := decodeMessage(message, handler)
+	if err != nil {
+		return err
+	}
+	o := *out
+	o.Content = content
+	pool.dispatch(&job{handler: handler, out: &o, conn: out.WSconnection.(*websocket.Conn), pending: pending})
+	return nil
+}
+
+func decodeMessage(message []byte, handler trigger.Handler) (interface{}, error) {
 	var content interface{}
 	if (handler.Settings()["format"] != nil && handler.Settings()["format"].(string) == "JSON") ||
 		(handler.Settings()["format"] == nil && isJSON(message)) {
 		err := json.NewDecoder(bytes.NewBuffer(message)).Decode(&content)
 		if err != nil {
-			return fmt.Errorf("JSON Message decoding Failed [%s] ", err)
+			return nil, fmt.Errorf("JSON Message decoding Failed [%s] ", err)
 		}
 	} else {
 		content = string(message)
 
 	}
-	out.Content = content
-	_, err := handler.Handle(context.Background(), out)
-	if err != nil {
-		return fmt.Errorf("Run action  failed [%s] ", err)
-	}
-	return nil
+	return content, nil
 }
 
 func isJSON(str []byte) bool {
@@ -0,0 +1,33 @@
+// Package wslock serializes the writes to a websocket connection shared by a
+// trigger and the flows it starts. A connection supports one concurrent
+// writer, the triggers pass their connections to the flows as wsconnection
+// and activities writing to such a connection must do it through this package
+package wslock
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var locks sync.Map
+
+// For returns the write lock of the connection
+func For(conn *websocket.Conn) sync.Locker {
+	lock, _ := locks.LoadOrStore(conn, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// WriteMessage writes a data message while holding the write lock of the
+// connection. Control messages can be sent with WriteControl without the lock
+func WriteMessage(conn *websocket.Conn, messageType int, data []byte) error {
+	lock := For(conn)
+	lock.Lock()
+	defer lock.Unlock()
+	return conn.WriteMessage(messageType, data)
+}
+
+// Release forgets the write lock of a closed connection
+func Release(conn *websocket.Conn) {
+	locks.Delete(conn)
+}
@@ -0,0 +1,57 @@
+package wslock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMessage(t *testing.T) {
+	received := make(chan string, 100)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(message)
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, For(conn), For(conn))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.Nil(t, WriteMessage(conn, websocket.TextMessage, []byte("hello")))
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "hello", <-received)
+	}
+
+	lock := For(conn)
+	Release(conn)
+	assert.True(t, lock != For(conn), "a released connection gets a new lock")
+	Release(conn)
+}